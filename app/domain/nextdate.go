@@ -2,45 +2,97 @@ package domain
 
 import (
 	"errors"
-	"strconv"
-	"strings"
 	"time"
 )
 
-func GetNextDate(now time.Time, date string, repeat string) (string, error) {
-	if repeat == "" {
-		return "", errors.New("repeat is empty string")
-	} else if strings.Contains(repeat, "d ") {
-		days, err := strconv.Atoi(strings.TrimPrefix(repeat, "d "))
-		if err != nil {
-			return "", err
-		}
-		if days > 400 {
-			return "", errors.New("days is greater than 400")
-		}
+const (
+	dateFormat = "20060102"
+	// TimeFormat is the time of day of a task.
+	TimeFormat = "15:04"
+	// maxYear is the last year a date can be written in dateFormat.
+	maxYear = 9999
+)
 
-		pdate, err := time.Parse("20060102", date)
-		if err != nil {
-			return "", err
+// ErrSeriesEnded is returned when a repeat rule has no occurrences left,
+// the series also ends after maxYear.
+var ErrSeriesEnded = errors.New("series has ended")
+
+// At is the time of day of a task and the time zone it is in. The zero At is a task
+// without a time, its dates are compared with now as they are.
+type At struct {
+	// Time is in TimeFormat, empty means the task has no time.
+	Time string
+	// Location is the time zone of the task, nil means the zone of now.
+	Location *time.Location
+}
+
+// now returns the moment the next occurrence is searched from. With a time zone
+// the date of now is taken in it, and with a time the day counts only until its
+// time has passed. The result is just before midnight of that day, so the rules
+// return that day or a later one.
+func (a At) now(now time.Time) time.Time {
+	if a.Time == "" && a.Location == nil {
+		return now
+	}
+	if a.Location != nil {
+		now = now.In(a.Location)
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if clock, err := time.Parse(TimeFormat, a.Time); err == nil {
+		if now.Hour()*60+now.Minute() >= clock.Hour()*60+clock.Minute() {
+			day = day.AddDate(0, 0, 1)
 		}
-		newDate := pdate.AddDate(0, 0, days)
+	}
+	return day.Add(-time.Nanosecond)
+}
 
-		for newDate.Before(now) {
-			newDate = newDate.AddDate(0, 0, days)
+// AdvanceRepeat returns the next date of a repeating task whose current occurrence is done
+// and the repeat rule to store with it. RRULE counts are reduced by the occurrences passed.
+// The time of day and the time zone of the task are taken into account with at.
+func AdvanceRepeat(now time.Time, date string, repeat string, at At) (string, string, error) {
+	rule, err := ParseRepeat(repeat)
+	if err != nil {
+		return "", "", err
+	}
+
+	pdate, err := time.Parse(dateFormat, date)
+	if err != nil {
+		return "", "", err
+	}
+
+	now = at.now(now)
+	var next time.Time
+	if rrule, ok := rule.(RRule); ok && rrule.Count > 0 {
+		next, rrule = rrule.Advance(now, pdate)
+		repeat = rrule.String()
+	} else {
+		next = rule.NextAfter(now, pdate)
+	}
+	if next.IsZero() || next.Year() > maxYear {
+		return "", "", ErrSeriesEnded
+	}
+	return next.Format(dateFormat), repeat, nil
+}
+
+// GetNextDates returns up to count next dates of a repeating task, fewer if the series ends
+// or reaches maxYear. The first date takes at into account as AdvanceRepeat does.
+func GetNextDates(now time.Time, date string, repeat string, count int, at At) ([]string, error) {
+	var dates []string
+	for len(dates) < count {
+		next, nextRepeat, err := AdvanceRepeat(now, date, repeat, at)
+		if errors.Is(err, ErrSeriesEnded) && len(dates) > 0 {
+			break
 		}
-		return newDate.Format("20060102"), nil
-	} else if repeat == "y" {
-		pdate, err := time.Parse("20060102", date)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		newDate := pdate.AddDate(1, 0, 0)
-		for newDate.Before(now) {
-			newDate = newDate.AddDate(1, 0, 0)
+		dates = append(dates, next)
+
+		// each following date is the one after the previous occurrence
+		if now, err = time.Parse(dateFormat, next); err != nil {
+			return nil, err
 		}
-		return newDate.Format("20060102"), nil
-	} else {
-		return "", errors.New("repeat is not valid")
+		date, repeat, at = next, nextRepeat, At{}
 	}
-
+	return dates, nil
 }
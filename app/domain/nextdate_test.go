@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNextDates(t *testing.T) {
+	now := parseDate(t, "20240126")
+	dates, err := GetNextDates(now, "20240101", "FREQ=DAILY;INTERVAL=10;COUNT=6", 10, At{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20240131", "20240210", "20240220"}, dates)
+
+	// the dates stop at the last year that can be written
+	dates, err = GetNextDates(now, "20240126", "FREQ=YEARLY;INTERVAL=400", 100, At{})
+	assert.NoError(t, err)
+	assert.Len(t, dates, 19)
+	assert.Equal(t, "96240126", dates[len(dates)-1])
+
+	dates, err = GetNextDates(now, "99970101", "y", 10, At{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"99980101", "99990101"}, dates)
+
+	_, err = GetNextDates(now, "99990101", "d 400", 1, At{})
+	assert.ErrorIs(t, err, ErrSeriesEnded)
+}
+
+func TestGetNextDatesAt(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+	// 10:30 in Moscow on January 26
+	now := time.Date(2024, 1, 26, 7, 30, 0, 0, time.UTC)
+	tbl := []struct {
+		at   At
+		want []string
+	}{
+		{At{}, []string{"20240127", "20240128"}},
+		{At{Time: "11:00", Location: moscow}, []string{"20240126", "20240127"}},
+		{At{Time: "10:00", Location: moscow}, []string{"20240127", "20240128"}},
+		// 07:30 in UTC has not reached 09:00 yet
+		{At{Time: "09:00"}, []string{"20240126", "20240127"}},
+	}
+	for _, v := range tbl {
+		dates, err := GetNextDates(now, "20240101", "d 1", 2, v.at)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, dates, v.at.Time)
+	}
+}
@@ -0,0 +1,306 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxDailyInterval = 400
+	// a monthly rule is checked against every month of a leap year,
+	// so NextAfter always finds a date within a few years
+	leapYear = 2024
+)
+
+// Rule is a parsed repeat rule of a task.
+type Rule interface {
+	// NextAfter returns the next date of the task scheduled on start, or the zero time
+	// if the series has ended. The date is after start; the d and y rules return
+	// the first one not before now, the w, m and RRULE rules the first one after now.
+	NextAfter(now, start time.Time) time.Time
+	// String returns the rule in the repeat syntax.
+	String() string
+}
+
+// RepeatError describes an invalid repeat rule and the token that caused it.
+type RepeatError struct {
+	Repeat string
+	Token  string
+	Msg    string
+}
+
+func (e *RepeatError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid repeat %q: %s", e.Repeat, e.Msg)
+	}
+	return fmt.Sprintf("invalid repeat %q: %s: %q", e.Repeat, e.Msg, e.Token)
+}
+
+// DailyRule repeats a task every Days days: "d <days>".
+type DailyRule struct {
+	Days int
+}
+
+func (r DailyRule) NextAfter(now, start time.Time) time.Time {
+	next := start.AddDate(0, 0, r.Days)
+	for next.Before(now) {
+		next = next.AddDate(0, 0, r.Days)
+	}
+	return next
+}
+
+func (r DailyRule) String() string {
+	return fmt.Sprintf("d %d", r.Days)
+}
+
+// YearlyRule repeats a task every year: "y".
+type YearlyRule struct{}
+
+func (r YearlyRule) NextAfter(now, start time.Time) time.Time {
+	next := start.AddDate(1, 0, 0)
+	for next.Before(now) {
+		next = next.AddDate(1, 0, 0)
+	}
+	return next
+}
+
+func (r YearlyRule) String() string {
+	return "y"
+}
+
+// WeeklyRule repeats a task on the listed weekdays: "w <1..7,...>", where 1 is Monday and 7 is Sunday.
+type WeeklyRule struct {
+	Weekdays []time.Weekday
+}
+
+func (r WeeklyRule) NextAfter(now, start time.Time) time.Time {
+	next := laterOf(now, start).AddDate(0, 0, 1)
+	for !r.matches(next) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (r WeeklyRule) matches(date time.Time) bool {
+	for _, v := range r.Weekdays {
+		if date.Weekday() == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r WeeklyRule) String() string {
+	days := make([]string, len(r.Weekdays))
+	for i, v := range r.Weekdays {
+		if v == time.Sunday {
+			days[i] = "7"
+			continue
+		}
+		days[i] = strconv.Itoa(int(v))
+	}
+	return "w " + strings.Join(days, ",")
+}
+
+// MonthlyRule repeats a task on the listed days of the listed months: "m <days> [<months>]".
+// Days are 1..31 or -1, -2 for the last and second-to-last day of a month.
+// An empty Months list means every month.
+type MonthlyRule struct {
+	Days   []int
+	Months []time.Month
+}
+
+func (r MonthlyRule) NextAfter(now, start time.Time) time.Time {
+	next := laterOf(now, start).AddDate(0, 0, 1)
+	for !r.matches(next) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (r MonthlyRule) matches(date time.Time) bool {
+	if !r.inMonth(date.Month()) {
+		return false
+	}
+	lastDay := daysIn(date.Year(), date.Month())
+	for _, v := range r.Days {
+		if v == date.Day() || v < 0 && lastDay+v+1 == date.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r MonthlyRule) inMonth(month time.Month) bool {
+	if len(r.Months) == 0 {
+		return true
+	}
+	for _, v := range r.Months {
+		if v == month {
+			return true
+		}
+	}
+	return false
+}
+
+// feasible reports whether at least one of the days exists in one of the months.
+func (r MonthlyRule) feasible() bool {
+	for month := time.January; month <= time.December; month++ {
+		if !r.inMonth(month) {
+			continue
+		}
+		for _, v := range r.Days {
+			if v < 0 || v <= daysIn(leapYear, month) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r MonthlyRule) String() string {
+	days := make([]string, len(r.Days))
+	for i, v := range r.Days {
+		days[i] = strconv.Itoa(v)
+	}
+	rule := "m " + strings.Join(days, ",")
+	if len(r.Months) > 0 {
+		months := make([]string, len(r.Months))
+		for i, v := range r.Months {
+			months[i] = strconv.Itoa(int(v))
+		}
+		rule += " " + strings.Join(months, ",")
+	}
+	return rule
+}
+
+// ParseRepeat parses the repeat field of a task.
+func ParseRepeat(repeat string) (Rule, error) {
+	if repeat == "" {
+		return nil, &RepeatError{Repeat: repeat, Msg: "repeat is empty string"}
+	}
+	if isRRule(repeat) {
+		rule, err := parseRRule(repeat)
+		if err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+	tokens := strings.Split(repeat, " ")
+	p := repeatParser{repeat: repeat}
+
+	switch tokens[0] {
+	case "d":
+		if len(tokens) != 2 {
+			return nil, p.argsError(tokens, 1)
+		}
+		days, err := p.number(tokens[1], 1, maxDailyInterval)
+		if err != nil {
+			return nil, err
+		}
+		return DailyRule{Days: days}, nil
+	case "y":
+		if len(tokens) != 1 {
+			return nil, p.argsError(tokens, 0)
+		}
+		return YearlyRule{}, nil
+	case "w":
+		if len(tokens) != 2 {
+			return nil, p.argsError(tokens, 1)
+		}
+		list, err := p.list(tokens[1], 1, 7)
+		if err != nil {
+			return nil, err
+		}
+		rule := WeeklyRule{}
+		for _, v := range list {
+			rule.Weekdays = append(rule.Weekdays, time.Weekday(v%7))
+		}
+		return rule, nil
+	case "m":
+		if len(tokens) != 2 && len(tokens) != 3 {
+			return nil, p.argsError(tokens, 2)
+		}
+		days, err := p.list(tokens[1], -2, 31)
+		if err != nil {
+			return nil, err
+		}
+		rule := MonthlyRule{}
+		for _, v := range days {
+			if v == 0 {
+				return nil, &RepeatError{Repeat: repeat, Token: tokens[1], Msg: "day must not be 0"}
+			}
+			rule.Days = append(rule.Days, v)
+		}
+		if len(tokens) == 3 {
+			months, err := p.list(tokens[2], 1, 12)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range months {
+				rule.Months = append(rule.Months, time.Month(v))
+			}
+		}
+		if !rule.feasible() {
+			return nil, &RepeatError{Repeat: repeat, Msg: "days never occur in the given months"}
+		}
+		return rule, nil
+	default:
+		return nil, &RepeatError{Repeat: repeat, Token: tokens[0], Msg: "unknown rule"}
+	}
+}
+
+type repeatParser struct {
+	repeat string
+}
+
+// argsError reports a wrong number of arguments after the rule letter.
+func (p repeatParser) argsError(tokens []string, want int) error {
+	if len(tokens) > want+1 {
+		return &RepeatError{Repeat: p.repeat, Token: tokens[want+1], Msg: "unexpected token"}
+	}
+	return &RepeatError{Repeat: p.repeat, Token: tokens[0], Msg: "missing argument for rule"}
+}
+
+func (p repeatParser) number(token string, min, max int) (int, error) {
+	n, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, &RepeatError{Repeat: p.repeat, Token: token, Msg: "not a number"}
+	}
+	if n < min || n > max {
+		return 0, &RepeatError{Repeat: p.repeat, Token: token, Msg: fmt.Sprintf("must be between %d and %d", min, max)}
+	}
+	return n, nil
+}
+
+// list parses a comma-separated list of numbers, sorted and without duplicates.
+func (p repeatParser) list(token string, min, max int) ([]int, error) {
+	seen := make(map[int]bool)
+	var list []int
+	for _, v := range strings.Split(token, ",") {
+		n, err := p.number(v, min, max)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[n] {
+			seen[n] = true
+			list = append(list, n)
+		}
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRepeat(t *testing.T) {
+	tbl := []struct {
+		repeat string
+		rule   Rule
+	}{
+		{"d 1", DailyRule{Days: 1}},
+		{"d 400", DailyRule{Days: 400}},
+		{"y", YearlyRule{}},
+		{"w 7,1,1", WeeklyRule{Weekdays: []time.Weekday{time.Monday, time.Sunday}}},
+		{"m 15,-1", MonthlyRule{Days: []int{-1, 15}}},
+		{"m 29 2,1", MonthlyRule{Days: []int{29}, Months: []time.Month{time.January, time.February}}},
+	}
+	for _, v := range tbl {
+		rule, err := ParseRepeat(v.repeat)
+		if assert.NoError(t, err, v.repeat) {
+			assert.Equal(t, v.rule, rule, v.repeat)
+			// the canonical form parses back into the same rule
+			again, err := ParseRepeat(rule.String())
+			assert.NoError(t, err, rule.String())
+			assert.Equal(t, rule, again, rule.String())
+		}
+	}
+}
+
+func TestParseRepeatErrors(t *testing.T) {
+	tbl := []struct {
+		repeat string
+		token  string
+		msg    string
+	}{
+		{"", "", "repeat is empty string"},
+		{"x 1", "x", "unknown rule"},
+		{"d", "d", "missing argument for rule"},
+		{"d 401", "401", "must be between 1 and 400"},
+		{"d 0", "0", "must be between 1 and 400"},
+		{"d seven", "seven", "not a number"},
+		{"y 1", "1", "unexpected token"},
+		{"w 8", "8", "must be between 1 and 7"},
+		{"w 1,,2", "", "not a number"},
+		{"w 1 2", "2", "unexpected token"},
+		{"m 0", "0", "day must not be 0"},
+		{"m -3", "-3", "must be between -2 and 31"},
+		{"m 1 13", "13", "must be between 1 and 12"},
+		{"m 1 2 3", "3", "unexpected token"},
+		{"m 30,31 2", "", "days never occur in the given months"},
+	}
+	for _, v := range tbl {
+		_, err := ParseRepeat(v.repeat)
+		var repeatErr *RepeatError
+		if assert.True(t, errors.As(err, &repeatErr), "%q: %v", v.repeat, err) {
+			assert.Equal(t, v.repeat, repeatErr.Repeat)
+			assert.Equal(t, v.token, repeatErr.Token, v.repeat)
+			assert.Equal(t, v.msg, repeatErr.Msg, v.repeat)
+		}
+	}
+}
+
+func TestRuleNextAfter(t *testing.T) {
+	tbl := []struct {
+		repeat     string
+		now, start string
+		want       string
+	}{
+		{"d 7", "20240101", "20240101", "20240108"},
+		{"d 7", "20240120", "20240101", "20240122"},
+		// d and y return now itself, w and m the first date after it
+		{"d 7", "20240108", "20240101", "20240108"},
+		{"w 1", "20240108", "20240101", "20240115"},
+		{"y", "20240101", "20240229", "20250301"},
+		// Monday and Sunday
+		{"w 1,7", "20240103", "20240101", "20240107"},
+		{"m -1", "20240201", "20240115", "20240229"},
+		{"m 29 2", "20240301", "20240101", "20280229"},
+	}
+	for _, v := range tbl {
+		rule, err := ParseRepeat(v.repeat)
+		if !assert.NoError(t, err, v.repeat) {
+			continue
+		}
+		assert.Equal(t, v.want, rule.NextAfter(parseDate(t, v.now), parseDate(t, v.start)).Format(dateFormat), v.repeat)
+	}
+}
@@ -0,0 +1,328 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rrulePrefix      = "RRULE:"
+	maxRRuleYears    = 8
+	maxRRuleInterval = 400
+	maxRRuleCount    = 1000
+	rruleUntilTime   = "20060102T150405Z"
+)
+
+// Frequency is the FREQ part of an RRULE.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRule is a subset of the RFC 5545 recurrence rule:
+// FREQ, INTERVAL, BYDAY (without ordinals), BYMONTHDAY, BYMONTH, COUNT and UNTIL.
+// The task date is the start of the series and counts as its first occurrence.
+type RRule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	ByMonth    []time.Month
+	// Count is the number of occurrences in the series, 0 means unlimited.
+	Count int
+	// Until is the last date of the series, the zero time means unlimited.
+	Until time.Time
+}
+
+// NextAfter returns the first occurrence after both now and start,
+// or the zero time if the series has ended before it.
+func (r RRule) NextAfter(now, start time.Time) time.Time {
+	next, _ := r.next(now, start)
+	return next
+}
+
+// next also returns the number of occurrences from start up to, but not including, the returned date.
+func (r RRule) next(now, start time.Time) (time.Time, int) {
+	now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	after := laterOf(now, start)
+	limit := after.AddDate(maxRRuleYears+r.interval(), 0, 0)
+	if !r.Until.IsZero() && r.Until.Before(limit) {
+		limit = r.Until
+	}
+
+	// the start is always an occurrence, the rest is searched day by day;
+	// without COUNT the days before now need not be counted
+	passed := 1
+	date := start.AddDate(0, 0, 1)
+	if r.Count == 0 && date.Before(after) {
+		date = after
+	}
+	for ; !date.After(limit); date = date.AddDate(0, 0, 1) {
+		if !r.matches(start, date) {
+			continue
+		}
+		if r.Count > 0 && passed >= r.Count {
+			break
+		}
+		if date.After(after) {
+			return date, passed
+		}
+		passed++
+	}
+	return time.Time{}, passed
+}
+
+// Advance returns the rule for a series that continues from next, with COUNT reduced
+// by the occurrences between start and next.
+func (r RRule) Advance(now, start time.Time) (time.Time, RRule) {
+	next, passed := r.next(now, start)
+	if r.Count > 0 {
+		r.Count -= passed
+	}
+	return next, r
+}
+
+func (r RRule) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+func (r RRule) matches(start, date time.Time) bool {
+	switch r.Freq {
+	case Daily:
+		if int(date.Sub(start).Hours()/24)%r.interval() != 0 {
+			return false
+		}
+	case Weekly:
+		weeks := int(weekStart(date).Sub(weekStart(start)).Hours() / 24 / 7)
+		if weeks%r.interval() != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 && date.Weekday() != start.Weekday() {
+			return false
+		}
+	case Monthly:
+		months := (date.Year()-start.Year())*12 + int(date.Month()-start.Month())
+		if months%r.interval() != 0 {
+			return false
+		}
+		if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 && date.Day() != start.Day() {
+			return false
+		}
+	case Yearly:
+		if (date.Year()-start.Year())%r.interval() != 0 {
+			return false
+		}
+		if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+			if date.Day() != start.Day() {
+				return false
+			}
+			if len(r.ByMonth) == 0 && date.Month() != start.Month() {
+				return false
+			}
+		}
+	}
+
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, date.Month()) {
+		return false
+	}
+	if len(r.ByDay) > 0 && !containsWeekday(r.ByDay, date.Weekday()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 {
+		lastDay := daysIn(date.Year(), date.Month())
+		found := false
+		for _, v := range r.ByMonthDay {
+			if v == date.Day() || v < 0 && lastDay+v+1 == date.Day() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, v := range r.ByMonth {
+			months[i] = strconv.Itoa(int(v))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, v := range r.ByMonthDay {
+			days[i] = strconv.Itoa(v)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, v := range r.ByDay {
+			days[i] = strings.ToUpper(v.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format(dateFormat))
+	}
+	return strings.Join(parts, ";")
+}
+
+func isRRule(repeat string) bool {
+	return strings.HasPrefix(repeat, rrulePrefix) || strings.Contains(repeat, "=")
+}
+
+func parseRRule(repeat string) (RRule, error) {
+	p := repeatParser{repeat: repeat}
+	var rule RRule
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(strings.TrimPrefix(repeat, rrulePrefix), ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return RRule{}, &RepeatError{Repeat: repeat, Token: part, Msg: "expected NAME=VALUE"}
+		}
+		if seen[key] {
+			return RRule{}, &RepeatError{Repeat: repeat, Token: part, Msg: "duplicate rule part"}
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			switch Frequency(value) {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = Frequency(value)
+			default:
+				return RRule{}, &RepeatError{Repeat: repeat, Token: value, Msg: "unsupported frequency"}
+			}
+		case "INTERVAL":
+			rule.Interval, err = p.number(value, 1, maxRRuleInterval)
+		case "COUNT":
+			rule.Count, err = p.number(value, 1, maxRRuleCount)
+		case "UNTIL":
+			rule.Until, err = time.Parse(dateFormat, value)
+			if err != nil {
+				rule.Until, err = time.Parse(rruleUntilTime, value)
+			}
+			if err != nil {
+				return RRule{}, &RepeatError{Repeat: repeat, Token: value, Msg: "invalid date"}
+			}
+			rule.Until = rule.Until.Truncate(24 * time.Hour)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, ok := rruleWeekdays[v]
+				if !ok {
+					return RRule{}, &RepeatError{Repeat: repeat, Token: v, Msg: "invalid weekday"}
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := p.number(v, -31, 31)
+				if err != nil {
+					return RRule{}, err
+				}
+				if day == 0 {
+					return RRule{}, &RepeatError{Repeat: repeat, Token: v, Msg: "day must not be 0"}
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		case "BYMONTH":
+			months, err := p.list(value, 1, 12)
+			if err != nil {
+				return RRule{}, err
+			}
+			for _, v := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(v))
+			}
+		default:
+			return RRule{}, &RepeatError{Repeat: repeat, Token: key, Msg: "unsupported rule part"}
+		}
+		if err != nil {
+			return RRule{}, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return RRule{}, &RepeatError{Repeat: repeat, Msg: "FREQ is required"}
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return RRule{}, &RepeatError{Repeat: repeat, Token: "UNTIL", Msg: "must not be used with COUNT"}
+	}
+	if !rule.feasible() {
+		return RRule{}, &RepeatError{Repeat: repeat, Msg: "days never occur in the given months"}
+	}
+	return rule, nil
+}
+
+// feasible reports whether at least one of the BYMONTHDAY days exists in one of
+// the BYMONTH months, a negative day counts from the end of the month.
+func (r RRule) feasible() bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	for month := time.January; month <= time.December; month++ {
+		if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, month) {
+			continue
+		}
+		for _, v := range r.ByMonthDay {
+			if v <= daysIn(leapYear, month) && -v <= daysIn(leapYear, month) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func weekStart(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7
+	return date.AddDate(0, 0, -offset)
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, v := range months {
+		if v == month {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, v := range days {
+		if v == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRRuleNextAfter(t *testing.T) {
+	tbl := []struct {
+		rrule      string
+		now, start string
+		// want is empty when the series has ended
+		want string
+	}{
+		// the next date is after now even if now is an occurrence
+		{"FREQ=DAILY;INTERVAL=7", "20240108", "20240101", "20240115"},
+		// every other week on Monday and Wednesday, 2024-01-01 is a Monday
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "20240101", "20240101", "20240103"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "20240103", "20240101", "20240115"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "20240120", "20240101", "20240129"},
+		{"FREQ=WEEKLY;INTERVAL=3;BYDAY=FR", "20240101", "20240101", "20240105"},
+		{"FREQ=WEEKLY;INTERVAL=3;BYDAY=FR", "20240105", "20240101", "20240126"},
+		// the last and the second to last days of the month
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "20240201", "20240131", "20240229"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "20240229", "20240131", "20240331"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-2", "20240101", "20240101", "20240130"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-2", "20240201", "20240101", "20240228"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1", "20240301", "20240229", "20250228"},
+		// the start is the first of the COUNT occurrences
+		{"FREQ=DAILY;COUNT=3", "20240101", "20240101", "20240102"},
+		{"FREQ=DAILY;COUNT=3", "20240102", "20240101", "20240103"},
+		{"FREQ=DAILY;COUNT=3", "20240103", "20240101", ""},
+		{"FREQ=DAILY;COUNT=1", "20240101", "20240101", ""},
+		{"FREQ=WEEKLY;BYDAY=MO,FR;COUNT=4", "20240108", "20240101", "20240112"},
+		{"FREQ=WEEKLY;BYDAY=MO,FR;COUNT=4", "20240112", "20240101", ""},
+		// UNTIL is the last date of the series
+		{"FREQ=WEEKLY;UNTIL=20240115", "20240108", "20240101", "20240115"},
+		{"FREQ=WEEKLY;UNTIL=20240115", "20240115", "20240101", ""},
+		{"FREQ=WEEKLY;UNTIL=20240114", "20240108", "20240101", ""},
+		{"FREQ=DAILY;UNTIL=20240103T235959Z", "20240102", "20240101", "20240103"},
+	}
+	for _, v := range tbl {
+		rule, err := ParseRepeat(v.rrule)
+		if !assert.NoError(t, err, v.rrule) {
+			continue
+		}
+		next := rule.NextAfter(parseDate(t, v.now), parseDate(t, v.start))
+		if v.want == "" {
+			assert.True(t, next.IsZero(), "%s from %s: %s", v.rrule, v.now, next)
+			continue
+		}
+		assert.Equal(t, v.want, next.Format(dateFormat), "%s from %s", v.rrule, v.now)
+	}
+}
+
+func TestRRuleAdvance(t *testing.T) {
+	rule, err := parseRRule("FREQ=DAILY;INTERVAL=2;COUNT=5")
+	assert.NoError(t, err)
+
+	// 01, 03 and 05 have passed, the series continues from 07 with 2 occurrences
+	next, rest := rule.Advance(parseDate(t, "20240105"), parseDate(t, "20240101"))
+	assert.Equal(t, "20240107", next.Format(dateFormat))
+	assert.Equal(t, 2, rest.Count)
+	assert.Equal(t, "FREQ=DAILY;INTERVAL=2;COUNT=2", rest.String())
+
+	next, rest = rest.Advance(next, next)
+	assert.Equal(t, "20240109", next.Format(dateFormat))
+	assert.Equal(t, 1, rest.Count)
+	next, _ = rest.Advance(next, next)
+	assert.True(t, next.IsZero())
+}
+
+func TestParseRRule(t *testing.T) {
+	rule, err := parseRRule("RRULE:FREQ=MONTHLY;INTERVAL=2;BYMONTH=6,1;BYMONTHDAY=1,-1;UNTIL=20251231T120000Z")
+	assert.NoError(t, err)
+	assert.Equal(t, RRule{
+		Freq:       Monthly,
+		Interval:   2,
+		ByMonth:    []time.Month{time.January, time.June},
+		ByMonthDay: []int{1, -1},
+		Until:      parseDate(t, "20251231"),
+	}, rule)
+	assert.Equal(t, "FREQ=MONTHLY;INTERVAL=2;BYMONTH=1,6;BYMONTHDAY=1,-1;UNTIL=20251231", rule.String())
+
+	// each of these days occurs in at least one of the months
+	for _, v := range []string{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "FREQ=DAILY;BYMONTH=2,3;BYMONTHDAY=30",
+		"FREQ=MONTHLY;BYMONTHDAY=-31", "FREQ=MONTHLY;BYMONTHDAY=31"} {
+		_, err := ParseRepeat(v)
+		assert.NoError(t, err, v)
+	}
+
+	tbl := []struct {
+		rrule string
+		token string
+		msg   string
+	}{
+		{"FREQ=DAILY;COUNT=2;UNTIL=20250101", "UNTIL", "must not be used with COUNT"},
+		{"UNTIL=20250101;FREQ=WEEKLY;COUNT=2", "UNTIL", "must not be used with COUNT"},
+		{"FREQ=DAILY;COUNT=0", "0", "must be between 1 and 1000"},
+		{"FREQ=DAILY;COUNT=1001", "1001", "must be between 1 and 1000"},
+		{"FREQ=DAILY;INTERVAL=401", "401", "must be between 1 and 400"},
+		{"FREQ=HOURLY", "HOURLY", "unsupported frequency"},
+		{"FREQ=DAILY;FREQ=WEEKLY", "FREQ=WEEKLY", "duplicate rule part"},
+		{"FREQ=WEEKLY;BYDAY=1MO", "1MO", "invalid weekday"},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", "0", "day must not be 0"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-32", "-32", "must be between -31 and 31"},
+		{"FREQ=YEARLY;BYMONTH=13", "13", "must be between 1 and 12"},
+		{"FREQ=DAILY;UNTIL=2025-01-01", "2025-01-01", "invalid date"},
+		{"FREQ=DAILY;WKST=MO", "WKST", "unsupported rule part"},
+		{"FREQ=DAILY;COUNT", "COUNT", "expected NAME=VALUE"},
+		{"INTERVAL=2", "", "FREQ is required"},
+		{"FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30", "", "days never occur in the given months"},
+		{"FREQ=YEARLY;BYMONTH=4,6;BYMONTHDAY=31", "", "days never occur in the given months"},
+		{"FREQ=MONTHLY;BYMONTH=2;BYMONTHDAY=-30", "", "days never occur in the given months"},
+	}
+	for _, v := range tbl {
+		_, err := ParseRepeat(v.rrule)
+		var repeatErr *RepeatError
+		if assert.True(t, errors.As(err, &repeatErr), "%q: %v", v.rrule, err) {
+			assert.Equal(t, v.token, repeatErr.Token, v.rrule)
+			assert.Equal(t, v.msg, repeatErr.Msg, v.rrule)
+		}
+	}
+}
+
+func parseDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	date, err := time.Parse(dateFormat, s)
+	assert.NoError(t, err)
+	return date
+}
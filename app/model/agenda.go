@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/domain"
+)
+
+// maxOccurrenceSteps stops expanding a repeating task with a repeat_count that starts
+// long before the range, or a range with too many occurrences of a task.
+const maxOccurrenceSteps = 10000
+
+// ListAgenda returns a page of the task occurrences between filter.From and filter.To.
+// The occurrences of a day are ordered by time, priority and position.
+// A repeating task is expanded virtually: it appears once for every date of the range it
+// falls on, with Date set to that date. The tasks themselves are not changed.
+// Only the first MaxRangeTasks tasks are expanded, the page is marked as truncated
+// when there are more or when the occurrences of a task are cut.
+func ListAgenda(store TaskStore, filter TaskFilter) (TaskPage, error) {
+	tasks, err := store.ListTasksInRange(filter)
+	if err != nil {
+		return TaskPage{}, err
+	}
+	truncated := len(tasks) > MaxRangeTasks
+	if truncated {
+		tasks = tasks[:MaxRangeTasks]
+	}
+
+	var occurrences []Task
+	for _, task := range tasks {
+		dates, cut, err := Occurrences(task, filter.From, filter.To)
+		if err != nil {
+			return TaskPage{}, err
+		}
+		truncated = truncated || cut
+		for _, date := range dates {
+			occurrence := task
+			occurrence.Date = date
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		a, b := occurrences[i], occurrences[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date != filter.Desc
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time != filter.Desc
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority != filter.Desc
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position != filter.Desc
+		}
+		idA, _ := strconv.Atoi(a.ID)
+		idB, _ := strconv.Atoi(b.ID)
+		return idA < idB != filter.Desc
+	})
+
+	page := TaskPage{Total: len(occurrences), Truncated: truncated}
+	if filter.Offset >= len(occurrences) {
+		return page, nil
+	}
+	occurrences = occurrences[filter.Offset:]
+	if len(occurrences) > filter.Limit {
+		occurrences = occurrences[:filter.Limit]
+	}
+	page.Tasks = occurrences
+	return page, nil
+}
+
+// Occurrences returns the dates of the task between from and to, taking its repeat rule,
+// repeat_until and repeat_count into account. It also reports whether the dates were cut
+// after maxOccurrenceSteps.
+func Occurrences(task Task, from, to string) ([]string, bool, error) {
+	// the occurrences follow each other by date, the time of day does not matter;
+	// without a repeat_count the ones before the range need not be counted
+	if len(task.Repeat) > 0 && task.RepeatCount == 0 && task.Date < from {
+		start, err := time.Parse(DateFormat, from)
+		if err != nil {
+			return nil, false, err
+		}
+		err = task.advance(start.AddDate(0, 0, -1), domain.At{})
+		if errors.Is(err, domain.ErrSeriesEnded) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var dates []string
+	for step := 0; task.Date <= to; step++ {
+		if step == maxOccurrenceSteps {
+			return dates, true, nil
+		}
+		if task.Date >= from {
+			dates = append(dates, task.Date)
+		}
+		if len(task.Repeat) == 0 {
+			break
+		}
+
+		now, err := time.Parse(DateFormat, task.Date)
+		if err != nil {
+			return nil, false, err
+		}
+		err = task.advance(now, domain.At{})
+		if errors.Is(err, domain.ErrSeriesEnded) {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return dates, false, nil
+}
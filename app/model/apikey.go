@@ -0,0 +1,137 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Scopes of the API keys.
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+const (
+	MaxKeyName = 64
+	// apiKeyPrefix starts every key, so a leaked key is easy to recognize.
+	apiKeyPrefix = "todo_"
+	// keyPrefixLen is the beginning of a key that is kept to tell the keys apart.
+	keyPrefixLen = len(apiKeyPrefix) + 8
+)
+
+// APIKey lets a script call the API as the owner of the key, without signing in.
+// A read key can only make GET requests.
+type APIKey struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// Key is only returned when the key is created, the store keeps Hash.
+	Key        string `json:"key,omitempty"`
+	Hash       string `json:"-"`
+	Prefix     string `json:"prefix"`
+	OwnerID    int    `json:"-"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// CheckCorrectData checks the name and the scope of a new key, a key without a scope
+// can only read.
+func (k *APIKey) CheckCorrectData() error {
+	k.Name = strings.TrimSpace(k.Name)
+	if len(k.Name) == 0 {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(k.Name) > MaxKeyName {
+		return fmt.Errorf("name must not be longer than %d characters", MaxKeyName)
+	}
+	switch k.Scope {
+	case "":
+		k.Scope = ScopeRead
+	case ScopeRead, ScopeReadWrite:
+	default:
+		return fmt.Errorf("scope must be %s or %s", ScopeRead, ScopeReadWrite)
+	}
+	return nil
+}
+
+// Generate sets a new random key and its hash.
+func (k *APIKey) Generate() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	k.Key = apiKeyPrefix + hex.EncodeToString(secret)
+	k.Hash = HashAPIKey(k.Key)
+	k.Prefix = k.Key[:keyPrefixLen]
+	return nil
+}
+
+// HashAPIKey returns the hash the key is stored with. The keys are random,
+// so a fast hash is enough to keep them secret.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const apiKeyColumns = `id, owner_id, name, scope, prefix, created_at, last_used_at`
+
+func (k *APIKey) fields() []any {
+	return []any{&k.ID, &k.OwnerID, &k.Name, &k.Scope, &k.Prefix, &k.CreatedAt, &k.LastUsedAt}
+}
+
+func (s Db) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.conn().Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE owner_id = :owner ORDER BY id`, sql.Named("owner", s.owner))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(key.fields()...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s Db) InsertAPIKey(key APIKey) (int, error) {
+	var id int
+	err := s.conn().QueryRow(`INSERT INTO api_keys (owner_id, name, scope, key_hash, prefix, created_at) VALUES (:owner, :name, :scope, :key_hash, :prefix, :created_at) RETURNING id`,
+		sql.Named("owner", s.owner),
+		sql.Named("name", key.Name),
+		sql.Named("scope", key.Scope),
+		sql.Named("key_hash", key.Hash),
+		sql.Named("prefix", key.Prefix),
+		sql.Named("created_at", key.CreatedAt)).Scan(&id)
+	return id, err
+}
+
+func (s Db) DeleteAPIKey(id int) (int64, error) {
+	res, err := s.conn().Exec(`DELETE FROM api_keys WHERE id = :id AND owner_id = :owner`, sql.Named("id", id), sql.Named("owner", s.owner))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UseAPIKey returns the key with the hash, whoever owns it, and records when it was used.
+func (s Db) UseAPIKey(hash string) (APIKey, error) {
+	var key APIKey
+	err := s.conn().QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = :key_hash`, sql.Named("key_hash", hash)).Scan(key.fields()...)
+	if err != nil {
+		return key, err
+	}
+	key.LastUsedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = s.conn().Exec(`UPDATE api_keys SET last_used_at = :last_used_at WHERE id = :id`,
+		sql.Named("last_used_at", key.LastUsedAt), sql.Named("id", key.ID))
+	return key, err
+}
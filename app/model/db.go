@@ -2,170 +2,565 @@ package model
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Db is the TaskStore for SQLite and PostgreSQL.
 type Db struct {
-	db *sql.DB
+	db     *sql.DB
+	driver string
+	// owner is the account whose tasks and tags the queries see
+	owner int
 }
 
-func NewDB(db *sql.DB) Db {
-	return Db{db: db}
+// NewDB returns the store of the admin account, ForOwner gives the stores of the others.
+func NewDB(db *sql.DB, driver string) Db {
+	return Db{db: db, driver: driver, owner: AdminID}
 }
 
-var Database Db
+func (s Db) ForOwner(id int) TaskStore {
+	s.owner = id
+	return s
+}
 
-func NewDataBase(filePath string) (Db, error) {
-	db, err := sql.Open("sqlite", filePath)
+func NewDataBase(driver string, dsn string) (Db, error) {
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return Db{}, err
 	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return Db{}, err
+	}
 
-	return NewDB(db), nil
+	return NewDB(db, driver), nil
 }
 
-func (d Db) Close() error {
-	return d.db.Close()
+type sqlConn interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
-func (s Db) CreateSchedulerTable() error {
-	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS scheduler (
-		id INTEGER PRIMARY KEY,
-		date TEXT,
-		title TEXT,
-		comment TEXT,
-		repeat TEXT
-		)`)
-	if err != nil {
+// conn runs queries on a *sql.DB or *sql.Tx. The queries use :name parameters,
+// which are rewritten to $n for PostgreSQL.
+type conn struct {
+	sqlConn
+	driver string
+}
 
-		return err
-	}
-	return nil
+func (s Db) conn() conn {
+	return conn{sqlConn: s.db, driver: s.driver}
+}
+
+func (s Db) withTx(tx *sql.Tx) conn {
+	return conn{sqlConn: tx, driver: s.driver}
+}
+
+func (c conn) Exec(query string, args ...any) (sql.Result, error) {
+	query, args = c.bind(query, args)
+	return c.sqlConn.Exec(query, args...)
+}
+
+func (c conn) Query(query string, args ...any) (*sql.Rows, error) {
+	query, args = c.bind(query, args)
+	return c.sqlConn.Query(query, args...)
+}
+
+func (c conn) QueryRow(query string, args ...any) *sql.Row {
+	query, args = c.bind(query, args)
+	return c.sqlConn.QueryRow(query, args...)
 }
 
-func (s Db) CreateIndex() error {
-	_, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_date ON scheduler (date)`)
-	return err
+// bind replaces :name parameters with $n and orders the named args accordingly.
+func (c conn) bind(query string, args []any) (string, []any) {
+	if c.driver != DriverPostgres || len(args) == 0 {
+		return query, args
+	}
+
+	named := make(map[string]any)
+	for _, v := range args {
+		if arg, ok := v.(sql.NamedArg); ok {
+			named[arg.Name] = arg.Value
+		}
+	}
+
+	var b strings.Builder
+	var bound []any
+	positions := make(map[string]int)
+	for i := 0; i < len(query); i++ {
+		if query[i] != ':' {
+			b.WriteByte(query[i])
+			continue
+		}
+		j := i + 1
+		for j < len(query) && (query[j] == '_' || query[j] >= 'a' && query[j] <= 'z' || query[j] >= '0' && query[j] <= '9') {
+			j++
+		}
+		name := query[i+1 : j]
+		value, ok := named[name]
+		if !ok {
+			b.WriteByte(query[i])
+			continue
+		}
+		pos, ok := positions[name]
+		if !ok {
+			bound = append(bound, value)
+			pos = len(bound)
+			positions[name] = pos
+		}
+		b.WriteString("$" + strconv.Itoa(pos))
+		i = j - 1
+	}
+	return b.String(), bound
+}
 
+func (d Db) Close() error {
+	return d.db.Close()
 }
 
 func (s Db) InsertTask(task Task) (int, error) {
-	res, err := s.db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES (:date, :title, :comment, :repeat)`,
-		sql.Named("date", task.Date),
-		sql.Named("title", task.Title),
-		sql.Named("comment", task.Comment),
-		sql.Named("repeat", task.Repeat))
+	var id int
+	err := s.inTx(func(c conn) error {
+		if task.ListID != 0 {
+			var n int
+			err := c.QueryRow(`SELECT COUNT(*) FROM lists WHERE id = :list_id AND id IN (`+writableLists+`)`,
+				sql.Named("list_id", task.ListID), sql.Named("owner", s.owner)).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+		}
+		err := c.QueryRow(`INSERT INTO scheduler (owner_id, list_id, date, title, comment, repeat, repeat_until, repeat_count, start_time, duration, timezone, priority, position) VALUES (:owner, :list_id, :date, :title, :comment, :repeat, :repeat_until, :repeat_count, :start_time, :duration, :timezone, :priority, :position) RETURNING id`,
+			sql.Named("owner", s.owner),
+			sql.Named("list_id", task.ListID),
+			sql.Named("date", task.Date),
+			sql.Named("title", task.Title),
+			sql.Named("comment", task.Comment),
+			sql.Named("repeat", task.Repeat),
+			sql.Named("repeat_until", task.RepeatUntil),
+			sql.Named("repeat_count", task.RepeatCount),
+			sql.Named("start_time", task.Time),
+			sql.Named("duration", task.Duration),
+			sql.Named("timezone", task.TimeZone),
+			sql.Named("priority", task.Priority),
+			sql.Named("position", task.Position)).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return s.setTaskTags(c, id, task.Tags)
+	})
 	if err != nil {
 		return 0, err
 	}
+	return id, nil
+}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, err
+// sortColumns are the expressions the tasks are ordered by before their id,
+// they match the values of a Cursor.
+var sortColumns = map[string][]string{
+	SortDate:     {"scheduler.date", "scheduler.start_time"},
+	SortTitle:    {"scheduler.title"},
+	SortCreated:  nil,
+	SortPriority: {"scheduler.date", "-scheduler.priority", "scheduler.position"},
+	SortRank:     {"scheduler.date", "scheduler.start_time"},
+}
+
+// ftsRank orders the full-text matches by relevance, a match in the title weighs more.
+const ftsRank = "bm25(scheduler_fts, 10.0, 1.0)"
+
+const taskColumns = `scheduler.id, scheduler.list_id, scheduler.date, scheduler.title, scheduler.comment, scheduler.repeat, scheduler.repeat_until, scheduler.repeat_count, scheduler.start_time, scheduler.duration, scheduler.timezone, scheduler.priority, scheduler.position`
+
+// fields returns the scan destinations for taskColumns.
+func (t *Task) fields() []any {
+	return []any{&t.ID, &t.ListID, &t.Date, &t.Title, &t.Comment, &t.Repeat, &t.RepeatUntil, &t.RepeatCount, &t.Time, &t.Duration, &t.TimeZone, &t.Priority, &t.Position}
+}
+
+// taskQuery is the part of a task listing that selects the visible tasks matching the filter.
+type taskQuery struct {
+	from  string
+	where []string
+	args  []any
+	// fts is set when the search uses the full-text index
+	fts bool
+}
+
+func (s Db) taskQuery(filter TaskFilter) taskQuery {
+	q := taskQuery{from: "scheduler", where: []string{visibleTask + " AND archived = 0 AND deleted = 0"},
+		args: []any{sql.Named("owner", s.owner)}}
+	if filter.ListID != nil {
+		q.where = append(q.where, "scheduler.list_id = :list_id")
+		q.args = append(q.args, sql.Named("list_id", *filter.ListID))
 	}
-	return int(id), nil
+	if len(filter.Date) > 0 {
+		q.where = append(q.where, "date = :date")
+		q.args = append(q.args, sql.Named("date", filter.Date))
+	}
+	fts := (len(filter.Search) > 0 || len(filter.Conditions) > 0) && s.ftsAvailable()
+	if len(filter.Search) > 0 {
+		if match := ftsQuery(filter.Search); len(match) > 0 && fts {
+			q.from = "scheduler JOIN scheduler_fts ON scheduler_fts.rowid = scheduler.id"
+			q.where = append(q.where, "scheduler_fts MATCH :match")
+			q.args = append(q.args, sql.Named("match", match))
+			q.fts = true
+		} else {
+			q.where = append(q.where, "(scheduler.title LIKE :search OR scheduler.comment LIKE :search)")
+			q.args = append(q.args, sql.Named("search", "%"+filter.Search+"%"))
+		}
+	}
+	for i, c := range filter.Conditions {
+		cond, arg := compileCondition(c, fmt.Sprintf("q%d", i), fts)
+		q.where = append(q.where, cond)
+		q.args = append(q.args, arg)
+	}
+	return q
 }
 
-func (s Db) GetTasks() ([]Task, error) {
-	var tasks []Task
-	rows, err := s.db.Query(`SELECT id, date, title, comment, repeat FROM scheduler LIMIT :limit`, sql.Named("limit", LimitTask))
-	if err != nil {
-		return nil, err
+// compileCondition returns the SQL condition for a query term and its argument named name.
+// Text terms use the full-text index when fts is set.
+func compileCondition(c Condition, name string, fts bool) (string, any) {
+	var cond string
+	value := c.Value
+	switch c.Field {
+	case FieldText, FieldTitle, FieldComment:
+		search := c.Value
+		if strings.IndexFunc(search, unicode.IsSpace) >= 0 {
+			search = `"` + search + `"`
+		}
+		if match := ftsQuery(search); fts && len(match) > 0 {
+			if c.Field != FieldText {
+				match = c.Field + " : (" + match + ")"
+			}
+			cond, value = "scheduler.id IN (SELECT rowid FROM scheduler_fts WHERE scheduler_fts MATCH :"+name+")", match
+			break
+		}
+		value = "%" + c.Value + "%"
+		if c.Field == FieldText {
+			cond = "(scheduler.title LIKE :" + name + " OR scheduler.comment LIKE :" + name + ")"
+		} else {
+			cond = "scheduler." + c.Field + " LIKE :" + name
+		}
+	case FieldRepeat:
+		switch c.Value {
+		case RepeatAny:
+			cond, value = "repeat <> :"+name, ""
+		case RepeatNone:
+			cond, value = "repeat = :"+name, ""
+		default:
+			if c.fullRule() {
+				cond = "repeat = :" + name
+			} else {
+				cond, value = "repeat LIKE :"+name, c.Value+"%"
+			}
+		}
+	case FieldTag:
+		cond = "scheduler.id IN (SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name = :" + name + ")"
+	case FieldDate:
+		cond = "date " + c.Op + " :" + name
 	}
-	defer rows.Close()
+	if c.Negate {
+		cond = "NOT " + cond
+	}
+	return cond, sql.Named(name, value)
+}
 
+// columns returns the selected columns, with the snippet and the rank of a full-text match.
+func (q taskQuery) columns() string {
+	if q.fts {
+		return taskColumns + `, snippet(scheduler_fts, -1, char(2), char(3), '…', 12), ` + ftsRank
+	}
+	return taskColumns
+}
+
+func (q taskQuery) scan(rows *sql.Rows) ([]Task, error) {
+	var tasks []Task
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
-		if err != nil {
+		dest := task.fields()
+		if q.fts {
+			dest = append(dest, &task.Snippet, &task.rank)
+		}
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
+		task.Snippet = highlight(task.Snippet)
 		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// ftsAvailable reports whether the full-text index exists, otherwise the search falls back to LIKE.
+func (s Db) ftsAvailable() bool {
+	if s.driver != DriverSQLite {
+		return false
+	}
+	var n int
+	err := s.conn().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'scheduler_fts'`).Scan(&n)
+	return err == nil && n > 0
+}
+
+func (s Db) ListTasks(filter TaskFilter) (TaskPage, error) {
+	q := s.taskQuery(filter)
 
+	var page TaskPage
+	err := s.conn().QueryRow(`SELECT COUNT(*) FROM `+q.from+` WHERE `+strings.Join(q.where, " AND "), q.args...).Scan(&page.Total)
+	if err != nil {
+		return page, err
+	}
+
+	columns, dir, cmp := sortColumns[filter.Sort], "ASC", ">"
+	// the tasks of equal relevance go by date
+	ranked := filter.Sort == SortRank && q.fts
+	if ranked {
+		columns = append([]string{ftsRank}, columns...)
+	}
+	if filter.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	columns = append(columns[:len(columns):len(columns)], "scheduler.id")
+	order := make([]string, len(columns))
+	for i, column := range columns {
+		order[i] = column + " " + dir
+	}
+	where, args := q.where, q.args
+	if filter.After != nil {
+		// the row value comparison continues after the cursor in the sort order
+		values := append(filter.After.values(), filter.After.ID)
+		if ranked {
+			values = append([]any{filter.After.Rank}, values...)
+		}
+		params := make([]string, len(values))
+		for i, v := range values {
+			params[i] = fmt.Sprintf(":after%d", i)
+			args = append(args, sql.Named(fmt.Sprintf("after%d", i), v))
+		}
+		where = append(where, "("+strings.Join(columns, ", ")+") "+cmp+" ("+strings.Join(params, ", ")+")")
+	}
+	// one more task than the page tells whether there is a next page
+	args = append(args, sql.Named("limit", filter.Limit+1), sql.Named("offset", filter.Offset))
+
+	rows, err := s.conn().Query(`SELECT `+q.columns()+` FROM `+q.from+` WHERE `+
+		strings.Join(where, " AND ")+` ORDER BY `+strings.Join(order, ", ")+` LIMIT :limit OFFSET :offset`, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	if page.Tasks, err = q.scan(rows); err != nil {
+		return page, err
+	}
+	if err := loadTags(s.conn(), page.Tasks); err != nil {
+		return page, err
+	}
+
+	if len(page.Tasks) > filter.Limit {
+		page.Tasks = page.Tasks[:filter.Limit]
+		last := page.Tasks[len(page.Tasks)-1]
+		id, err := strconv.Atoi(last.ID)
+		if err != nil {
+			return page, err
+		}
+		page.Next = filter.cursor(last, id)
 	}
+	return page, nil
+}
+
+func (s Db) ListTasksInRange(filter TaskFilter) ([]Task, error) {
+	q := s.taskQuery(filter)
+	where := append(q.where, "date <= :to AND (date >= :from OR repeat <> '')")
+	args := append(q.args, sql.Named("from", filter.From), sql.Named("to", filter.To), sql.Named("limit", MaxRangeTasks+1))
 
-	return tasks, nil
+	rows, err := s.conn().Query(`SELECT `+q.columns()+` FROM `+q.from+` WHERE `+
+		strings.Join(where, " AND ")+` ORDER BY scheduler.date, scheduler.id LIMIT :limit`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks, err := q.scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, loadTags(s.conn(), tasks)
 }
 
 func (s Db) GetTask(id int) (Task, error) {
+	return s.getTask(s.conn(), id, visibleTask)
+}
+
+// getTask reads a task the owner sees, visibleTask, or changes, writableTask,
+// with db or inside a transaction.
+func (s Db) getTask(c conn, id any, scope string) (Task, error) {
 	var task Task
-	err := s.db.QueryRow(`SELECT id, date, title, comment, repeat FROM scheduler WHERE id = :id`, sql.Named("id", id)).Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	err := c.QueryRow(`SELECT `+taskColumns+` FROM scheduler WHERE id = :id AND `+scope+` AND archived = 0 AND deleted = 0`,
+		sql.Named("id", id), sql.Named("owner", s.owner)).Scan(task.fields()...)
 	if err != nil {
 		return task, err
 	}
-	return task, nil
+	tasks := []Task{task}
+	if err := loadTags(c, tasks); err != nil {
+		return task, err
+	}
+	return tasks[0], nil
 }
 
 func (s Db) UpdateTask(task Task) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		res, err := c.Exec(`UPDATE scheduler SET date = :date, title = :title, comment = :comment, repeat = :repeat, repeat_until = :repeat_until, repeat_count = :repeat_count, start_time = :start_time, duration = :duration, timezone = :timezone, priority = :priority, position = :position WHERE id = :id AND `+writableTask+` AND archived = 0 AND deleted = 0`,
+			sql.Named("id", task.ID),
+			sql.Named("owner", s.owner),
+			sql.Named("date", task.Date),
+			sql.Named("title", task.Title),
+			sql.Named("comment", task.Comment),
+			sql.Named("repeat", task.Repeat),
+			sql.Named("repeat_until", task.RepeatUntil),
+			sql.Named("repeat_count", task.RepeatCount),
+			sql.Named("start_time", task.Time),
+			sql.Named("duration", task.Duration),
+			sql.Named("timezone", task.TimeZone),
+			sql.Named("priority", task.Priority),
+			sql.Named("position", task.Position))
+		if err != nil {
+			return err
+		}
 
-	res, err := s.db.Exec(`UPDATE scheduler SET date = :date, title = :title, comment = :comment, repeat = :repeat WHERE id = :id`,
-		sql.Named("id", task.ID),
-		sql.Named("date", task.Date),
-		sql.Named("title", task.Title),
-		sql.Named("comment", task.Comment),
-		sql.Named("repeat", task.Repeat))
+		rowsAffected, err = res.RowsAffected()
+		if err != nil || rowsAffected == 0 {
+			return err
+		}
+		return s.setTaskTags(c, task.ID, task.Tags)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	return rowsAffected, nil
+}
+
+func (s Db) ReorderTasks(ids []int) error {
+	return s.inTx(func(c conn) error {
+		for i, id := range ids {
+			res, err := c.Exec(`UPDATE scheduler SET position = :position WHERE id = :id AND `+writableTask+` AND archived = 0 AND deleted = 0`,
+				sql.Named("position", i), sql.Named("id", id), sql.Named("owner", s.owner))
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTask marks the task as deleted, it can be restored with the returned operation.
+func (s Db) DeleteTask(id int) (Operation, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return 0, err
+		return Operation{}, err
 	}
+	defer tx.Rollback()
+	c := s.withTx(tx)
 
-	return rowsAffected, nil
-}
+	prev, err := s.getTask(c, id, writableTask)
+	if err != nil {
+		return Operation{}, err
+	}
 
-func (s Db) DeleteTask(id int) (int64,error) {
+	_, err = c.Exec(`UPDATE scheduler SET deleted = 1 WHERE id = :id`, sql.Named("id", id))
+	if err != nil {
+		return Operation{}, err
+	}
 
-	res, err := s.db.Exec(`DELETE FROM scheduler WHERE id = :id`, sql.Named("id", id))
+	op, err := insertOperation(c, prev, 0)
 	if err != nil {
-		return 0,err
+		return Operation{}, err
 	}
-	return res.RowsAffected()
+	return op, tx.Commit()
 }
 
-func (s Db) GetTasksByDate(date string) ([]Task, error) {
-	var tasks []Task
-	rows, err := s.db.Query(`SELECT id, date, title, comment, repeat FROM scheduler WHERE date = :date LIMIT :limit`, sql.Named("date", date), sql.Named("limit", LimitTask))
+// CompleteTask records that the occurrence of the task scheduled on date is done and then
+// either archives the task or saves it with its next occurrence.
+// The previous state can be restored with the returned operation.
+func (s Db) CompleteTask(task Task, date string, archive bool) (Operation, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, err
+		return Operation{}, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
+	c := s.withTx(tx)
 
-	for rows.Next() {
-		var task Task
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
-		if err != nil {
-
-			return nil, err
-		}
+	prev, err := s.getTask(c, task.ID, writableTask)
+	if err != nil {
+		return Operation{}, err
+	}
 
-		tasks = append(tasks, task)
+	if archive {
+		_, err = c.Exec(`UPDATE scheduler SET archived = 1 WHERE id = :id`, sql.Named("id", task.ID))
+	} else {
+		_, err = c.Exec(`UPDATE scheduler SET date = :date, repeat = :repeat, repeat_count = :repeat_count WHERE id = :id`,
+			sql.Named("id", task.ID),
+			sql.Named("date", task.Date),
+			sql.Named("repeat", task.Repeat),
+			sql.Named("repeat_count", task.RepeatCount))
+	}
+	if err != nil {
+		return Operation{}, err
+	}
 
+	var completionID int64
+	err = c.QueryRow(`INSERT INTO task_completions (task_id, date, completed_at) VALUES (:task_id, :date, :completed_at) RETURNING id`,
+		sql.Named("task_id", task.ID),
+		sql.Named("date", date),
+		sql.Named("completed_at", time.Now().Format(time.RFC3339))).Scan(&completionID)
+	if err != nil {
+		return Operation{}, err
 	}
 
-	return tasks, nil
+	op, err := insertOperation(c, prev, completionID)
+	if err != nil {
+		return Operation{}, err
+	}
+	return op, tx.Commit()
 }
 
-func (s Db) GetTasksByTitleOrComment(search string) ([]Task, error) {
-	var tasks []Task
-	rows, err := s.db.Query(`SELECT id, date, title, comment, repeat FROM scheduler WHERE title LIKE :search OR comment LIKE :search ORDER BY date LIMIT :limit `, sql.Named("search", "%"+search+"%"), sql.Named("limit", LimitTask))
+func (s Db) GetCompletions(taskID int) ([]Completion, error) {
+	var completions []Completion
+	rows, err := s.conn().Query(`SELECT task_id, date, completed_at FROM task_completions
+		WHERE task_id = :task_id AND task_id IN (SELECT id FROM scheduler WHERE `+visibleTask+`) ORDER BY id`,
+		sql.Named("task_id", taskID), sql.Named("owner", s.owner))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var task Task
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+		var completion Completion
+		err := rows.Scan(&completion.TaskID, &completion.Date, &completion.CompletedAt)
 		if err != nil {
-
 			return nil, err
 		}
-		tasks = append(tasks, task)
+		completions = append(completions, completion)
 	}
 
-	return tasks, nil
+	return completions, rows.Err()
 }
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// SortDate orders by date and then by time, the tasks without a time come first in a day.
+	SortDate    = "date"
+	SortTitle   = "title"
+	SortCreated = "created"
+	// SortPriority orders by date, then by priority from the highest and then by position.
+	SortPriority = "priority"
+	// SortRank orders the results of a text search by relevance, best first.
+	SortRank = "rank"
+
+	MaxLimitTask = 500
+	// MaxRangeDays limits the window of a date range query.
+	MaxRangeDays = 366
+	// MaxRangeTasks limits the tasks expanded for a date range query.
+	MaxRangeTasks = 1000
+)
+
+// TaskFilter selects, orders and pages the tasks returned by ListTasks.
+type TaskFilter struct {
+	// Date is an exact date, empty means any date.
+	Date string
+	// ListID selects the tasks of a list, 0 the private tasks; nil means all the tasks.
+	ListID *int
+	// Search is a substring of the title or the comment.
+	Search string
+	// Conditions are the terms of a search query besides the text search.
+	Conditions []Condition
+	// From and To are the inclusive bounds of a date range, both empty means no range.
+	From string
+	To   string
+
+	Sort string
+	Desc bool
+	// Limit is the page size, 0 means LimitTask.
+	Limit  int
+	Offset int
+	// After continues the listing after the last task of the previous page.
+	After *Cursor
+}
+
+// TaskPage is a page of tasks, Total counts all tasks matching the filter.
+// Next is set when there are more tasks after the page.
+type TaskPage struct {
+	Tasks []Task
+	Total int
+	Next  *Cursor
+	// Truncated is set when a date range has more than MaxRangeTasks tasks: only the
+	// first ones by date are expanded, so Total and the occurrences miss the others.
+	Truncated bool
+}
+
+// Cursor points at a task in a listing: the value of the sort key and the task id.
+// The date sort also keeps the time, the priority sort the priority and the position of the task,
+// the rank sort the relevance and the date and time that order the tasks of equal relevance.
+type Cursor struct {
+	Sort     string  `json:"s"`
+	Key      string  `json:"k"`
+	Time     string  `json:"t,omitempty"`
+	Priority int     `json:"p,omitempty"`
+	Position int     `json:"o,omitempty"`
+	Rank     float64 `json:"r,omitempty"`
+	ID       int     `json:"i"`
+}
+
+// values returns the values the listing is ordered by before the task id,
+// in the order of sortColumns. A higher priority comes first, so it is negated.
+// The rank is left out, it is only ordered by when the search index ranks the tasks.
+func (c Cursor) values() []any {
+	switch strings.TrimPrefix(c.Sort, "-") {
+	case SortCreated:
+		return nil
+	case SortPriority:
+		return []any{c.Key, -c.Priority, c.Position}
+	case SortDate, SortRank:
+		return []any{c.Key, c.Time}
+	default:
+		return []any{c.Key}
+	}
+}
+
+// ParseSort parses a sort option: date, title, created, priority or rank, with a leading "-" for descending order.
+func ParseSort(sort string) (string, bool, error) {
+	desc := strings.HasPrefix(sort, "-")
+	sort = strings.TrimPrefix(sort, "-")
+	switch sort {
+	case "":
+		return SortDate, desc, nil
+	case SortDate, SortTitle, SortCreated, SortPriority, SortRank:
+		return sort, desc, nil
+	default:
+		return "", false, errors.New("sort must be date, title, created, priority or rank")
+	}
+}
+
+// ParseCursor decodes a cursor returned in a previous page.
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Check normalizes the paging options.
+func (f *TaskFilter) Check() error {
+	if len(f.Sort) == 0 {
+		f.Sort = SortDate
+	}
+	if f.Limit == 0 {
+		f.Limit = LimitTask
+	}
+	if f.Limit < 0 || f.Limit > MaxLimitTask {
+		return errors.New("limit is out of range")
+	}
+	if f.Offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+	if len(f.From) > 0 || len(f.To) > 0 {
+		if err := f.checkRange(); err != nil {
+			return err
+		}
+	}
+	if f.Sort == SortRank && len(f.Search) == 0 {
+		return errors.New("rank can only be used with a text search")
+	}
+	if f.After != nil {
+		if f.Offset > 0 {
+			return errors.New("offset can not be used with a cursor")
+		}
+		if f.After.Sort != f.sortKey() {
+			return errors.New("cursor does not match the sort order")
+		}
+	}
+	return nil
+}
+
+// Ranged reports whether the filter selects a date range.
+func (f TaskFilter) Ranged() bool {
+	return len(f.From) > 0
+}
+
+func (f TaskFilter) checkRange() error {
+	from, err := time.Parse(DateFormat, f.From)
+	if err != nil {
+		return errors.New("from must be a date in the format " + DateFormat)
+	}
+	to, err := time.Parse(DateFormat, f.To)
+	if err != nil {
+		return errors.New("to must be a date in the format " + DateFormat)
+	}
+	if to.Before(from) {
+		return errors.New("to must not be before from")
+	}
+	if to.Sub(from) >= MaxRangeDays*24*time.Hour {
+		return fmt.Errorf("date range must not exceed %d days", MaxRangeDays)
+	}
+	if len(f.Date) > 0 {
+		return errors.New("date search can not be used with a date range")
+	}
+	if f.Sort != SortDate {
+		return errors.New("a date range can only be sorted by date")
+	}
+	if f.After != nil {
+		return errors.New("cursor can not be used with a date range")
+	}
+	return nil
+}
+
+// sortKey identifies the sort order a cursor was made for.
+func (f TaskFilter) sortKey() string {
+	if f.Desc {
+		return "-" + f.Sort
+	}
+	return f.Sort
+}
+
+// cursor returns the cursor that points at the task.
+// Without a search index rank falls back to the date order.
+func (f TaskFilter) cursor(task Task, id int) *Cursor {
+	c := &Cursor{Sort: f.sortKey(), ID: id}
+	switch f.Sort {
+	case SortDate:
+		c.Key, c.Time = task.Date, task.Time
+	case SortRank:
+		c.Key, c.Time, c.Rank = task.Date, task.Time, task.rank
+	case SortPriority:
+		c.Key, c.Priority, c.Position = task.Date, task.Priority, task.Position
+	case SortTitle:
+		c.Key = task.Title
+	}
+	return c
+}
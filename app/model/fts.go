@@ -0,0 +1,46 @@
+package model
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// snippet marks written by the snippet() function around the matches
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// ftsQuery turns a search into an FTS5 query. Words match as prefixes, text in double
+// quotes matches as a phrase and all the terms must match. The terms are quoted, so the
+// FTS5 operators in the search are taken literally. It returns "" when nothing is left
+// to search for.
+func ftsQuery(search string) string {
+	var terms []string
+	for i, part := range strings.Split(search, `"`) {
+		// the odd parts are between quotes
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.FieldsFunc(part, notWordRune), " "); len(phrase) > 0 {
+				terms = append(terms, `"`+phrase+`"`)
+			}
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, notWordRune) {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// notWordRune splits a search the way the unicode61 tokenizer does.
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// highlight escapes a snippet for HTML and wraps the matches in <mark> tags.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, snippetClose, "</mark>")
+}
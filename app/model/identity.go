@@ -0,0 +1,33 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (s Db) IdentityUser(issuer, subject string) (User, error) {
+	var user User
+	err := s.conn().QueryRow(`SELECT `+userColumns+` FROM users WHERE id = (SELECT user_id FROM identities WHERE issuer = :issuer AND subject = :subject)`,
+		sql.Named("issuer", issuer), sql.Named("subject", subject)).Scan(user.fields()...)
+	return user, err
+}
+
+func (s Db) InsertIdentityUser(user User, issuer, subject string) (int, error) {
+	var id int
+	err := s.inTx(func(c conn) error {
+		var err error
+		if id, err = insertUser(c, user); err != nil {
+			return err
+		}
+		_, err = c.Exec(`INSERT INTO identities (issuer, subject, user_id, created_at) VALUES (:issuer, :subject, :user_id, :created_at)`,
+			sql.Named("issuer", issuer),
+			sql.Named("subject", subject),
+			sql.Named("user_id", id),
+			sql.Named("created_at", time.Now().UTC().Format(time.RFC3339)))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
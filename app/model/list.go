@@ -0,0 +1,336 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Permissions on a list, each one allows what the ones before it do:
+// read sees the tasks, write creates, changes and moves them, manage changes the list.
+const (
+	PermissionRead   = "read"
+	PermissionWrite  = "write"
+	PermissionManage = "manage"
+)
+
+const MaxListName = 64
+
+var permissionRanks = map[string]int{PermissionRead: 1, PermissionWrite: 2, PermissionManage: 3}
+
+var (
+	ErrNoUser       = errors.New("user does not exist")
+	ErrListNotEmpty = errors.New("the list has tasks, move or delete them first")
+)
+
+// List is a list of tasks shared by its members. The tasks without a list are private
+// to their owner.
+type List struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// OwnerID is the account that created the list, it manages the list.
+	OwnerID int `json:"owner_id"`
+	// Everyone is the permission of all the accounts, read or write,
+	// empty means only the members see the list.
+	Everyone string `json:"everyone,omitempty"`
+	// Members are the accounts the list is shared with. In an update nil keeps them.
+	Members []Member `json:"members"`
+	// Permission is what the account asking for the list can do with it.
+	Permission string `json:"permission,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// Member is an account a list is shared with.
+type Member struct {
+	UserID     int    `json:"user_id"`
+	Login      string `json:"login,omitempty"`
+	Permission string `json:"permission"`
+}
+
+// CheckCorrectData checks the name, the permissions and the members of the list,
+// a member without a permission can read.
+func (l *List) CheckCorrectData() error {
+	l.Name = strings.TrimSpace(l.Name)
+	if len(l.Name) == 0 {
+		return errors.New("name is required")
+	}
+	if utf8.RuneCountInString(l.Name) > MaxListName {
+		return fmt.Errorf("name must not be longer than %d characters", MaxListName)
+	}
+	if l.Everyone != "" && l.Everyone != PermissionRead && l.Everyone != PermissionWrite {
+		return fmt.Errorf("everyone must be empty, %s or %s", PermissionRead, PermissionWrite)
+	}
+	seen := make(map[int]bool)
+	for i := range l.Members {
+		m := &l.Members[i]
+		if m.UserID <= 0 {
+			return errors.New("member user_id is required")
+		}
+		if seen[m.UserID] {
+			return fmt.Errorf("user %d is a member twice", m.UserID)
+		}
+		seen[m.UserID] = true
+		if len(m.Permission) == 0 {
+			m.Permission = PermissionRead
+		}
+		if _, ok := permissionRanks[m.Permission]; !ok {
+			return fmt.Errorf("permission must be %s, %s or %s", PermissionRead, PermissionWrite, PermissionManage)
+		}
+	}
+	return nil
+}
+
+// PermissionOf returns what the account can do with the list, empty if it does not see it.
+func (l List) PermissionOf(userID int) string {
+	if l.OwnerID == userID {
+		return PermissionManage
+	}
+	permission := l.Everyone
+	for _, m := range l.Members {
+		if m.UserID == userID && permissionRanks[m.Permission] > permissionRanks[permission] {
+			permission = m.Permission
+		}
+	}
+	return permission
+}
+
+// Can reports whether the permission allows what the other one does.
+func Can(permission, other string) bool {
+	rank, ok := permissionRanks[permission]
+	return ok && rank >= permissionRanks[other]
+}
+
+// The lists the owner of a Db sees, changes the tasks of and manages.
+const (
+	readableLists = `SELECT id FROM lists WHERE owner_id = :owner OR everyone <> ''
+		OR id IN (SELECT list_id FROM list_members WHERE user_id = :owner)`
+	writableLists = `SELECT id FROM lists WHERE owner_id = :owner OR everyone = 'write'
+		OR id IN (SELECT list_id FROM list_members WHERE user_id = :owner AND permission IN ('write', 'manage'))`
+	managedLists = `SELECT id FROM lists WHERE owner_id = :owner
+		OR id IN (SELECT list_id FROM list_members WHERE user_id = :owner AND permission = 'manage')`
+)
+
+// visibleTask and writableTask select the tasks the owner of a Db sees and changes:
+// their own tasks without a list and the tasks of their lists.
+const (
+	visibleTask  = `(scheduler.list_id = 0 AND scheduler.owner_id = :owner OR scheduler.list_id IN (` + readableLists + `))`
+	writableTask = `(scheduler.list_id = 0 AND scheduler.owner_id = :owner OR scheduler.list_id IN (` + writableLists + `))`
+)
+
+func (s Db) ListLists() ([]List, error) {
+	return s.lists(s.conn(), `id IN (`+readableLists+`)`, sql.Named("owner", s.owner))
+}
+
+func (s Db) GetList(id int) (List, error) {
+	lists, err := s.lists(s.conn(), `id = :id AND id IN (`+readableLists+`)`, sql.Named("id", id), sql.Named("owner", s.owner))
+	if err != nil {
+		return List{}, err
+	}
+	if len(lists) == 0 {
+		return List{}, sql.ErrNoRows
+	}
+	return lists[0], nil
+}
+
+// lists returns the lists matching the condition with their members.
+func (s Db) lists(c conn, where string, args ...any) ([]List, error) {
+	rows, err := c.Query(`SELECT id, name, owner_id, everyone, created_at FROM lists WHERE `+where+` ORDER BY name, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make([]List, 0)
+	byID := make(map[int]int)
+	for rows.Next() {
+		var list List
+		if err := rows.Scan(&list.ID, &list.Name, &list.OwnerID, &list.Everyone, &list.CreatedAt); err != nil {
+			return nil, err
+		}
+		list.Members = make([]Member, 0)
+		id, _ := strconv.Atoi(list.ID)
+		byID[id] = len(lists)
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	members, err := c.Query(`SELECT list_members.list_id, list_members.user_id, users.login, list_members.permission
+		FROM list_members JOIN users ON users.id = list_members.user_id
+		WHERE list_members.list_id IN (SELECT id FROM lists WHERE `+where+`) ORDER BY users.login`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+	for members.Next() {
+		var listID int
+		var m Member
+		if err := members.Scan(&listID, &m.UserID, &m.Login, &m.Permission); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[listID]; ok {
+			lists[i].Members = append(lists[i].Members, m)
+		}
+	}
+	if err := members.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range lists {
+		lists[i].Permission = lists[i].PermissionOf(s.owner)
+	}
+	return lists, nil
+}
+
+// InsertList adds a list owned by the owner of the store, it returns ErrNoUser
+// if a member does not exist.
+func (s Db) InsertList(list List) (int, error) {
+	var id int
+	err := s.inTx(func(c conn) error {
+		err := c.QueryRow(`INSERT INTO lists (name, owner_id, everyone, created_at) VALUES (:name, :owner, :everyone, :created_at) RETURNING id`,
+			sql.Named("name", list.Name),
+			sql.Named("owner", s.owner),
+			sql.Named("everyone", list.Everyone),
+			sql.Named("created_at", time.Now().UTC().Format(time.RFC3339))).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return setMembers(c, id, list.Members)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateList renames a list the owner of the store manages and changes who it is
+// shared with, it returns ErrNoUser if a member does not exist.
+func (s Db) UpdateList(list List) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		res, err := c.Exec(`UPDATE lists SET name = :name, everyone = :everyone WHERE id = :id AND id IN (`+managedLists+`)`,
+			sql.Named("id", list.ID),
+			sql.Named("owner", s.owner),
+			sql.Named("name", list.Name),
+			sql.Named("everyone", list.Everyone))
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = res.RowsAffected()
+		if err != nil || rowsAffected == 0 || list.Members == nil {
+			return err
+		}
+		id, err := strconv.Atoi(list.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Exec(`DELETE FROM list_members WHERE list_id = :id`, sql.Named("id", id)); err != nil {
+			return err
+		}
+		return setMembers(c, id, list.Members)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// setMembers adds the members of a list.
+func setMembers(c conn, listID int, members []Member) error {
+	for _, m := range members {
+		var n int
+		if err := c.QueryRow(`SELECT COUNT(*) FROM users WHERE id = :id`, sql.Named("id", m.UserID)).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %d", ErrNoUser, m.UserID)
+		}
+		_, err := c.Exec(`INSERT INTO list_members (list_id, user_id, permission) VALUES (:list_id, :user_id, :permission)`,
+			sql.Named("list_id", listID), sql.Named("user_id", m.UserID), sql.Named("permission", m.Permission))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteList deletes a list the owner of the store manages, it returns ErrListNotEmpty
+// if the list still has active tasks. The archived and the deleted tasks of the list
+// are deleted with it, with their completions and operations.
+func (s Db) DeleteList(id int) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		var n int
+		err := c.QueryRow(`SELECT COUNT(*) FROM scheduler WHERE list_id = :id AND archived = 0 AND deleted = 0`, sql.Named("id", id)).Scan(&n)
+		if err != nil {
+			return err
+		}
+		res, err := c.Exec(`DELETE FROM lists WHERE id = :id AND id IN (`+managedLists+`)`, sql.Named("id", id), sql.Named("owner", s.owner))
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = res.RowsAffected(); err != nil || rowsAffected == 0 {
+			return err
+		}
+		if n > 0 {
+			return ErrListNotEmpty
+		}
+		// the archived tasks and the deleted ones waiting to be purged go with the list
+		// and so do their operations, the triggers delete their completions and tags
+		_, err = c.Exec(`DELETE FROM task_operations WHERE task_id IN (SELECT id FROM scheduler WHERE list_id = :id)`, sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		if _, err := c.Exec(`DELETE FROM scheduler WHERE list_id = :id`, sql.Named("id", id)); err != nil {
+			return err
+		}
+		_, err = c.Exec(`DELETE FROM list_members WHERE list_id = :id`, sql.Named("id", id))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// MoveTask moves a task the owner of the store can change to another list it can change,
+// list 0 makes the task a private task of the owner. Only the account that created
+// the task or a manager of its list takes it out of the list. It returns sql.ErrNoRows
+// when the task or the list is not found.
+func (s Db) MoveTask(id int, listID int) error {
+	return s.inTx(func(c conn) error {
+		owner := sql.Named("owner", s.owner)
+		if listID != 0 {
+			var n int
+			err := c.QueryRow(`SELECT COUNT(*) FROM lists WHERE id = :list_id AND id IN (`+writableLists+`)`,
+				sql.Named("list_id", listID), owner).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+		}
+		res, err := c.Exec(`UPDATE scheduler SET list_id = :list_id, owner_id = CASE WHEN :list_id = 0 THEN :owner ELSE owner_id END
+			WHERE id = :id AND archived = 0 AND deleted = 0 AND `+writableTask+`
+			AND (:list_id <> 0 OR owner_id = :owner OR list_id IN (`+managedLists+`))`,
+			sql.Named("id", id), sql.Named("list_id", listID), owner)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
@@ -0,0 +1,897 @@
+package model
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DriverMemory = "memory"
+
+type memoryTask struct {
+	Task
+	owner    int
+	archived bool
+	deleted  bool
+}
+
+type memoryTag struct {
+	name  string
+	owner int
+}
+
+type memoryCompletion struct {
+	Completion
+	id int64
+}
+
+// MemoryStore is a TaskStore that keeps everything in maps, it is meant for tests.
+type MemoryStore struct {
+	*memoryData
+	// owner is the account whose tasks and tags the methods see
+	owner int
+}
+
+// memoryData is shared by the stores of all the owners.
+type memoryData struct {
+	mu          sync.Mutex
+	lastID      int
+	tasks       map[int]*memoryTask
+	completions []memoryCompletion
+	lastCompID  int64
+	operations  []Operation
+	lastTagID   int
+	tags        map[int]memoryTag
+	lastUserID  int
+	users       map[int]User
+	// revoked are the expiry times of the revoked tokens
+	revoked   map[string]time.Time
+	lastKeyID int
+	keys      map[int]APIKey
+	// identities are the accounts of the issuer and subject pairs
+	identities map[[2]string]int
+	lastListID int
+	lists      map[int]List
+}
+
+// NewMemoryStore returns the store of the admin account, ForOwner gives the stores of the others.
+func NewMemoryStore() *MemoryStore {
+	data := &memoryData{
+		tasks:      make(map[int]*memoryTask),
+		tags:       make(map[int]memoryTag),
+		revoked:    make(map[string]time.Time),
+		keys:       make(map[int]APIKey),
+		identities: make(map[[2]string]int),
+		lists:      make(map[int]List),
+		lastUserID: AdminID,
+		users: map[int]User{
+			AdminID: {ID: strconv.Itoa(AdminID), Login: AdminLogin, Role: RoleAdmin, CreatedAt: time.Now().UTC().Format(time.RFC3339)},
+		},
+	}
+	return &MemoryStore{memoryData: data, owner: AdminID}
+}
+
+func (m *MemoryStore) ForOwner(id int) TaskStore {
+	return &MemoryStore{memoryData: m.memoryData, owner: id}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// task returns a task the owner has the permission on that is neither archived nor deleted.
+func (m *MemoryStore) task(id string, permission string) (*memoryTask, error) {
+	key, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	t, ok := m.tasks[key]
+	if !ok || !m.can(t, permission) || t.archived || t.deleted {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// can reports whether the owner has the permission on the task: its own tasks
+// without a list and the tasks of its lists.
+func (m *MemoryStore) can(t *memoryTask, permission string) bool {
+	if t.ListID == 0 {
+		return t.owner == m.owner
+	}
+	return Can(m.lists[t.ListID].PermissionOf(m.owner), permission)
+}
+
+// canList reports whether the owner has the permission on the list.
+func (m *MemoryStore) canList(id int, permission string) bool {
+	list, ok := m.lists[id]
+	return ok && Can(list.PermissionOf(m.owner), permission)
+}
+
+func (m *MemoryStore) InsertTask(task Task) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if task.ListID != 0 && !m.canList(task.ListID, PermissionWrite) {
+		return 0, sql.ErrNoRows
+	}
+	m.lastID++
+	task.ID = strconv.Itoa(m.lastID)
+	task.Tags = m.addTags(task.Tags)
+	m.tasks[m.lastID] = &memoryTask{Task: task, owner: m.owner}
+	return m.lastID, nil
+}
+
+func (m *MemoryStore) GetTask(id int) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.task(strconv.Itoa(id), PermissionRead)
+	if err != nil {
+		return Task{}, err
+	}
+	return t.Task, nil
+}
+
+func (m *MemoryStore) UpdateTask(task Task) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.task(task.ID, PermissionWrite)
+	if err != nil {
+		return 0, nil
+	}
+	if task.Tags == nil {
+		task.Tags = t.Tags
+	}
+	task.ListID = t.ListID
+	task.Tags = m.addTags(task.Tags)
+	t.Task = task
+	return 1, nil
+}
+
+func (m *MemoryStore) ReorderTasks(ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make([]*memoryTask, len(ids))
+	for i, id := range ids {
+		t, err := m.task(strconv.Itoa(id), PermissionWrite)
+		if err != nil {
+			return err
+		}
+		tasks[i] = t
+	}
+	for i, t := range tasks {
+		t.Position = i
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteTask(id int) (Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.task(strconv.Itoa(id), PermissionWrite)
+	if err != nil {
+		return Operation{}, err
+	}
+	op, err := m.addOperation(t.Task, 0)
+	if err != nil {
+		return Operation{}, err
+	}
+	t.deleted = true
+	return op, nil
+}
+
+// match returns the visible tasks matching the date and search filters.
+func (m *MemoryStore) match(filter TaskFilter) []Task {
+	search := strings.ToLower(filter.Search)
+	var tasks []Task
+	for _, t := range m.tasks {
+		if !m.can(t, PermissionRead) || t.archived || t.deleted {
+			continue
+		}
+		if filter.ListID != nil && t.ListID != *filter.ListID {
+			continue
+		}
+		if len(filter.Date) > 0 && t.Date != filter.Date {
+			continue
+		}
+		if len(search) > 0 && !strings.Contains(strings.ToLower(t.Title), search) &&
+			!strings.Contains(strings.ToLower(t.Comment), search) {
+			continue
+		}
+		if !matchAll(filter.Conditions, t.Task) {
+			continue
+		}
+		tasks = append(tasks, t.Task)
+	}
+	return tasks
+}
+
+// compareValues compares the sort values of two tasks, they are strings or ints.
+func compareValues(a, b []any) int {
+	for i := range a {
+		switch v := a[i].(type) {
+		case string:
+			if c := strings.Compare(v, b[i].(string)); c != 0 {
+				return c
+			}
+		case int:
+			if c := cmp.Compare(v, b[i].(int)); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func matchAll(conditions []Condition, task Task) bool {
+	for _, c := range conditions {
+		if !c.Match(task) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryStore) ListTasksInRange(filter TaskFilter) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []Task
+	for _, t := range m.match(filter) {
+		if t.Date <= filter.To && (t.Date >= filter.From || len(t.Repeat) > 0) {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Date != tasks[j].Date {
+			return tasks[i].Date < tasks[j].Date
+		}
+		idA, _ := strconv.Atoi(tasks[i].ID)
+		idB, _ := strconv.Atoi(tasks[j].ID)
+		return idA < idB
+	})
+	if len(tasks) > MaxRangeTasks+1 {
+		tasks = tasks[:MaxRangeTasks+1]
+	}
+	return tasks, nil
+}
+
+func (m *MemoryStore) ListTasks(filter TaskFilter) (TaskPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := m.match(filter)
+
+	// less orders the tasks by the sort values and then by id
+	less := func(a, b Task) bool {
+		idA, _ := strconv.Atoi(a.ID)
+		idB, _ := strconv.Atoi(b.ID)
+		if c := compareValues(filter.cursor(a, idA).values(), filter.cursor(b, idB).values()); c != 0 {
+			return c < 0 != filter.Desc
+		}
+		return idA < idB != filter.Desc
+	}
+	sort.Slice(tasks, func(i, j int) bool { return less(tasks[i], tasks[j]) })
+
+	page := TaskPage{Total: len(tasks)}
+	if filter.After != nil {
+		after := Task{ID: strconv.Itoa(filter.After.ID), Date: filter.After.Key, Title: filter.After.Key,
+			Time: filter.After.Time, Priority: filter.After.Priority, Position: filter.After.Position}
+		i := sort.Search(len(tasks), func(i int) bool { return less(after, tasks[i]) })
+		tasks = tasks[i:]
+	}
+	if filter.Offset < len(tasks) {
+		tasks = tasks[filter.Offset:]
+	} else {
+		tasks = nil
+	}
+	if len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+		last := tasks[len(tasks)-1]
+		id, _ := strconv.Atoi(last.ID)
+		page.Next = filter.cursor(last, id)
+	}
+	page.Tasks = tasks
+	return page, nil
+}
+
+func (m *MemoryStore) CompleteTask(task Task, date string, archive bool) (Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.task(task.ID, PermissionWrite)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	m.lastCompID++
+	op, err := m.addOperation(t.Task, m.lastCompID)
+	if err != nil {
+		return Operation{}, err
+	}
+	m.completions = append(m.completions, memoryCompletion{
+		Completion: Completion{TaskID: task.ID, Date: date, CompletedAt: time.Now().Format(time.RFC3339)},
+		id:         m.lastCompID,
+	})
+
+	if archive {
+		t.archived = true
+	} else {
+		t.Date, t.Repeat, t.RepeatCount = task.Date, task.Repeat, task.RepeatCount
+	}
+	return op, nil
+}
+
+func (m *MemoryStore) GetCompletions(taskID int) ([]Completion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.tasks[taskID]; !ok || !m.can(t, PermissionRead) {
+		return nil, nil
+	}
+	var completions []Completion
+	for _, c := range m.completions {
+		if c.TaskID == strconv.Itoa(taskID) {
+			completions = append(completions, c.Completion)
+		}
+	}
+	return completions, nil
+}
+
+func (m *MemoryStore) addOperation(prev Task, completionID int64) (Operation, error) {
+	id, err := newOperationID()
+	if err != nil {
+		return Operation{}, err
+	}
+	op := Operation{
+		ID:           id,
+		TaskID:       prev.ID,
+		Snapshot:     prev,
+		CompletionID: completionID,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	m.operations = append(m.operations, op)
+	return op, nil
+}
+
+func (m *MemoryStore) UndoOperation(id string, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// only the latest operation of a task can be undone
+	index := -1
+	for i, op := range m.operations {
+		if op.ID == id {
+			index = i
+		} else if index >= 0 && op.TaskID == m.operations[index].TaskID {
+			return sql.ErrNoRows
+		}
+	}
+	if index < 0 || m.operations[index].CreatedAt.Before(since.UTC().Truncate(time.Second)) {
+		return sql.ErrNoRows
+	}
+	op := m.operations[index]
+
+	key, _ := strconv.Atoi(op.TaskID)
+	t, ok := m.tasks[key]
+	if !ok || !m.can(t, PermissionWrite) {
+		return sql.ErrNoRows
+	}
+	listID := t.ListID
+	// moving a task is not undone
+	*t = memoryTask{Task: op.Snapshot, owner: t.owner}
+	t.ListID = listID
+	if op.CompletionID > 0 {
+		for i, c := range m.completions {
+			if c.id == op.CompletionID {
+				m.completions = append(m.completions[:i], m.completions[i+1:]...)
+				break
+			}
+		}
+	}
+	m.operations = append(m.operations[:index], m.operations[index+1:]...)
+	return nil
+}
+
+func (m *MemoryStore) PurgeOperations(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.operations[:0]
+	pending := make(map[string]bool)
+	for _, op := range m.operations {
+		if !op.CreatedAt.Before(before.UTC().Truncate(time.Second)) {
+			kept = append(kept, op)
+			pending[op.TaskID] = true
+		}
+	}
+	m.operations = kept
+
+	for id, t := range m.tasks {
+		if t.deleted && !pending[t.ID] {
+			delete(m.tasks, id)
+		}
+	}
+	return nil
+}
+
+// addTags creates the tags that do not exist yet, an empty list becomes nil
+// as it is read back from a database.
+func (m *MemoryStore) addTags(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		if m.tagID(name) == 0 {
+			m.lastTagID++
+			m.tags[m.lastTagID] = memoryTag{name: name, owner: m.owner}
+		}
+	}
+	return append([]string(nil), names...)
+}
+
+// tagID returns the id of the tag of the owner, 0 if there is none.
+func (m *MemoryStore) tagID(name string) int {
+	for id, v := range m.tags {
+		if v.name == name && v.owner == m.owner {
+			return id
+		}
+	}
+	return 0
+}
+
+func (m *MemoryStore) ListTags() ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tags := make([]Tag, 0)
+	for id, v := range m.tags {
+		if v.owner == m.owner {
+			tags = append(tags, Tag{ID: strconv.Itoa(id), Name: v.name})
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (m *MemoryStore) InsertTag(tag Tag) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tagID(tag.Name) != 0 {
+		return 0, ErrTagExists
+	}
+	m.lastTagID++
+	m.tags[m.lastTagID] = memoryTag{name: tag.Name, owner: m.owner}
+	return m.lastTagID, nil
+}
+
+func (m *MemoryStore) UpdateTag(tag Tag) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, _ := strconv.Atoi(tag.ID)
+	old, ok := m.tags[id]
+	if !ok || old.owner != m.owner {
+		return 0, nil
+	}
+	if other := m.tagID(tag.Name); other != 0 && other != id {
+		return 0, ErrTagExists
+	}
+	m.tags[id] = memoryTag{name: tag.Name, owner: m.owner}
+	m.renameTag(old.name, tag.Name)
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteTag(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.tags[id]
+	if !ok || old.owner != m.owner {
+		return 0, nil
+	}
+	delete(m.tags, id)
+	m.renameTag(old.name, "")
+	return 1, nil
+}
+
+// renameTag renames a tag on all tasks of the owner, an empty name removes it.
+func (m *MemoryStore) renameTag(old, name string) {
+	for _, t := range m.tasks {
+		if t.owner != m.owner {
+			continue
+		}
+		var tags []string
+		for _, v := range t.Tags {
+			if v != old {
+				tags = append(tags, v)
+			} else if len(name) > 0 {
+				tags = append(tags, name)
+			}
+		}
+		sort.Strings(tags)
+		t.Tags = tags
+	}
+}
+
+func (m *MemoryStore) ListUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+	return users, nil
+}
+
+func (m *MemoryStore) GetUser(id int) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) GetUserByLogin(login string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id := m.userID(login); id != 0 {
+		return m.users[id], nil
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) InsertUser(user User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertUser(user)
+}
+
+func (m *MemoryStore) insertUser(user User) (int, error) {
+	if m.userID(user.Login) != 0 {
+		return 0, ErrUserExists
+	}
+	m.lastUserID++
+	user.ID = strconv.Itoa(m.lastUserID)
+	user.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.users[m.lastUserID] = user
+	return m.lastUserID, nil
+}
+
+func (m *MemoryStore) UpdateUser(user User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, _ := strconv.Atoi(user.ID)
+	old, ok := m.users[id]
+	if !ok {
+		return 0, nil
+	}
+	if other := m.userID(user.Login); other != 0 && other != id {
+		return 0, ErrUserExists
+	}
+	user.CreatedAt = old.CreatedAt
+	user.TokenVersion = old.TokenVersion
+	if user.PasswordHash != old.PasswordHash {
+		user.TokenVersion++
+	}
+	m.users[id] = user
+	return 1, nil
+}
+
+// DeleteUser deletes an account with its private tasks, tags, API keys and identities.
+// Its tasks in the lists stay there and its lists go to the admin account.
+func (m *MemoryStore) DeleteUser(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return 0, nil
+	}
+	delete(m.users, id)
+	for key, t := range m.tasks {
+		if t.owner == id && t.ListID == 0 {
+			delete(m.tasks, key)
+		}
+	}
+	for key, list := range m.lists {
+		if list.OwnerID == id {
+			list.OwnerID = AdminID
+		}
+		list.Members = removeMember(list.Members, id)
+		m.lists[key] = list
+	}
+	for key, tag := range m.tags {
+		if tag.owner == id {
+			delete(m.tags, key)
+		}
+	}
+	for key, k := range m.keys {
+		if k.OwnerID == id {
+			delete(m.keys, key)
+		}
+	}
+	for key, user := range m.identities {
+		if user == id {
+			delete(m.identities, key)
+		}
+	}
+	return 1, nil
+}
+
+func (m *MemoryStore) userID(login string) int {
+	for id, user := range m.users {
+		if user.Login == login {
+			return id
+		}
+	}
+	return 0
+}
+
+func (m *MemoryStore) RevokeToken(id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, t := range m.revoked {
+		if t.Before(time.Now()) {
+			delete(m.revoked, key)
+		}
+	}
+	m.revoked[id] = expiresAt
+	return nil
+}
+
+func (m *MemoryStore) TokenRevoked(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+func (m *MemoryStore) ListAPIKeys() ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]APIKey, 0)
+	for _, k := range m.keys {
+		if k.OwnerID == m.owner {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.Atoi(keys[i].ID)
+		b, _ := strconv.Atoi(keys[j].ID)
+		return a < b
+	})
+	return keys, nil
+}
+
+func (m *MemoryStore) InsertAPIKey(key APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastKeyID++
+	key.ID = strconv.Itoa(m.lastKeyID)
+	key.OwnerID = m.owner
+	key.Key = ""
+	m.keys[m.lastKeyID] = key
+	return m.lastKeyID, nil
+}
+
+func (m *MemoryStore) DeleteAPIKey(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if k, ok := m.keys[id]; !ok || k.OwnerID != m.owner {
+		return 0, nil
+	}
+	delete(m.keys, id)
+	return 1, nil
+}
+
+func (m *MemoryStore) UseAPIKey(hash string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, k := range m.keys {
+		if k.Hash == hash {
+			k.LastUsedAt = time.Now().UTC().Format(time.RFC3339)
+			m.keys[id] = k
+			return k, nil
+		}
+	}
+	return APIKey{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) IdentityUser(issuer, subject string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.identities[[2]string{issuer, subject}]; ok {
+		return m.users[id], nil
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) InsertIdentityUser(user User, issuer, subject string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, err := m.insertUser(user)
+	if err != nil {
+		return 0, err
+	}
+	m.identities[[2]string{issuer, subject}] = id
+	return id, nil
+}
+
+func (m *MemoryStore) ListLists() ([]List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lists := make([]List, 0)
+	for id := range m.lists {
+		if m.canList(id, PermissionRead) {
+			lists = append(lists, m.list(id))
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Name != lists[j].Name {
+			return lists[i].Name < lists[j].Name
+		}
+		a, _ := strconv.Atoi(lists[i].ID)
+		b, _ := strconv.Atoi(lists[j].ID)
+		return a < b
+	})
+	return lists, nil
+}
+
+func (m *MemoryStore) GetList(id int) (List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canList(id, PermissionRead) {
+		return List{}, sql.ErrNoRows
+	}
+	return m.list(id), nil
+}
+
+// list returns a copy of the list with the logins of the members as the owner sees it.
+func (m *MemoryStore) list(id int) List {
+	list := m.lists[id]
+	members := make([]Member, 0, len(list.Members))
+	for _, v := range list.Members {
+		v.Login = m.users[v.UserID].Login
+		members = append(members, v)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Login < members[j].Login })
+	list.Members = members
+	list.Permission = list.PermissionOf(m.owner)
+	return list
+}
+
+// checkMembers returns ErrNoUser if a member does not exist.
+func (m *MemoryStore) checkMembers(members []Member) error {
+	for _, v := range members {
+		if _, ok := m.users[v.UserID]; !ok {
+			return fmt.Errorf("%w: %d", ErrNoUser, v.UserID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) InsertList(list List) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkMembers(list.Members); err != nil {
+		return 0, err
+	}
+	m.lastListID++
+	list.ID = strconv.Itoa(m.lastListID)
+	list.OwnerID = m.owner
+	list.Members = append([]Member(nil), list.Members...)
+	list.Permission = ""
+	list.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.lists[m.lastListID] = list
+	return m.lastListID, nil
+}
+
+func (m *MemoryStore) UpdateList(list List) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, _ := strconv.Atoi(list.ID)
+	if !m.canList(id, PermissionManage) {
+		return 0, nil
+	}
+	if err := m.checkMembers(list.Members); err != nil {
+		return 0, err
+	}
+	old := m.lists[id]
+	old.Name, old.Everyone = list.Name, list.Everyone
+	if list.Members != nil {
+		old.Members = append([]Member(nil), list.Members...)
+	}
+	m.lists[id] = old
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteList(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canList(id, PermissionManage) {
+		return 0, nil
+	}
+	for _, t := range m.tasks {
+		if t.ListID == id && !t.archived && !t.deleted {
+			return 0, ErrListNotEmpty
+		}
+	}
+	deleted := make(map[string]bool)
+	for key, t := range m.tasks {
+		if t.ListID == id {
+			deleted[t.ID] = true
+			delete(m.tasks, key)
+		}
+	}
+	m.completions = slices.DeleteFunc(m.completions, func(c memoryCompletion) bool {
+		return deleted[c.TaskID]
+	})
+	m.operations = slices.DeleteFunc(m.operations, func(op Operation) bool {
+		return deleted[op.TaskID]
+	})
+	delete(m.lists, id)
+	return 1, nil
+}
+
+func (m *MemoryStore) MoveTask(id int, listID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if listID != 0 && !m.canList(listID, PermissionWrite) {
+		return sql.ErrNoRows
+	}
+	t, err := m.task(strconv.Itoa(id), PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if listID == 0 && t.owner != m.owner && !m.canList(t.ListID, PermissionManage) {
+		return sql.ErrNoRows
+	}
+	t.ListID = listID
+	if listID == 0 {
+		t.owner = m.owner
+	}
+	return nil
+}
+
+// removeMember returns the members without the account.
+func removeMember(members []Member, userID int) []Member {
+	var kept []Member
+	for _, v := range members {
+		if v.UserID != userID {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
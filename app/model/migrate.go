@@ -0,0 +1,201 @@
+package model
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Migration is a schema change loaded from migrations/<driver>/NNNN_name.up.sql and NNNN_name.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database.
+type MigrationStatus struct {
+	Migration
+	AppliedAt string
+}
+
+func (m MigrationStatus) Applied() bool {
+	return len(m.AppliedAt) > 0
+}
+
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	files, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		name, direction, found := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), ".")
+		if !found || direction != "up" && direction != "down" {
+			return nil, fmt.Errorf("invalid migration file name: %s", file.Name())
+		}
+		number, title, found := strings.Cut(name, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", file.Name())
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", file.Name())
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (s Db) createSchemaVersionTable() error {
+	_, err := s.conn().Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+		)`)
+	return err
+}
+
+// MigrationStatus lists all known migrations and when they were applied.
+func (s Db) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(s.driver)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createSchemaVersionTable(); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]string)
+	rows, err := s.conn().Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Migration: m, AppliedAt: applied[m.Version]}
+	}
+	return status, nil
+}
+
+// MigrateUp applies all pending migrations in order, each in its own transaction.
+// It returns the applied migrations.
+func (s Db) MigrateUp() ([]Migration, error) {
+	status, err := s.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range status {
+		if m.Applied() {
+			continue
+		}
+		err := s.inTx(func(c conn) error {
+			if _, err := c.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := c.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (:version, :name, :applied_at)`,
+				sql.Named("version", m.Version),
+				sql.Named("name", m.Name),
+				sql.Named("applied_at", time.Now().UTC().Format(time.RFC3339)))
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the latest applied migration.
+// It returns false if there is nothing to revert.
+func (s Db) MigrateDown() (Migration, bool, error) {
+	status, err := s.MigrationStatus()
+	if err != nil {
+		return Migration{}, false, err
+	}
+
+	for i := len(status) - 1; i >= 0; i-- {
+		m := status[i]
+		if !m.Applied() {
+			continue
+		}
+		err := s.inTx(func(c conn) error {
+			if _, err := c.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := c.Exec(`DELETE FROM schema_version WHERE version = :version`, sql.Named("version", m.Version))
+			return err
+		})
+		if err != nil {
+			return Migration{}, false, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		return m.Migration, true, nil
+	}
+	return Migration{}, false, nil
+}
+
+func (s Db) inTx(f func(c conn) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(s.withTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_date;
+DROP TABLE IF EXISTS scheduler;
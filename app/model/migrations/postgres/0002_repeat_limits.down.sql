@@ -0,0 +1,2 @@
+ALTER TABLE scheduler DROP COLUMN repeat_count;
+ALTER TABLE scheduler DROP COLUMN repeat_until;
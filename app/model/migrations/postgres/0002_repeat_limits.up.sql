@@ -0,0 +1,2 @@
+ALTER TABLE scheduler ADD COLUMN repeat_until TEXT NOT NULL DEFAULT '';
+ALTER TABLE scheduler ADD COLUMN repeat_count INTEGER NOT NULL DEFAULT 0;
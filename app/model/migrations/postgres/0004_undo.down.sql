@@ -0,0 +1,5 @@
+DROP TABLE task_operations;
+DELETE FROM scheduler WHERE deleted = 1;
+DROP TRIGGER scheduler_delete_completions ON scheduler;
+DROP FUNCTION scheduler_delete_completions();
+ALTER TABLE scheduler DROP COLUMN deleted;
@@ -0,0 +1,21 @@
+ALTER TABLE scheduler ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+
+-- seq keeps the order the operations were made in
+CREATE TABLE task_operations (
+	seq BIGSERIAL PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	task_id INTEGER NOT NULL,
+	snapshot TEXT NOT NULL,
+	completion_id INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+CREATE FUNCTION scheduler_delete_completions() RETURNS trigger AS $$
+BEGIN
+	DELETE FROM task_completions WHERE task_id = OLD.id;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER scheduler_delete_completions AFTER DELETE ON scheduler
+	FOR EACH ROW EXECUTE FUNCTION scheduler_delete_completions();
@@ -0,0 +1,22 @@
+CREATE TABLE tags (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE task_tags (
+	task_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (task_id, tag_id)
+);
+
+CREATE INDEX idx_task_tags_tag ON task_tags (tag_id);
+
+CREATE FUNCTION scheduler_delete_tags() RETURNS trigger AS $$
+BEGIN
+	DELETE FROM task_tags WHERE task_id = OLD.id;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER scheduler_delete_tags AFTER DELETE ON scheduler
+	FOR EACH ROW EXECUTE FUNCTION scheduler_delete_tags();
@@ -0,0 +1,2 @@
+ALTER TABLE scheduler DROP COLUMN position;
+ALTER TABLE scheduler DROP COLUMN priority;
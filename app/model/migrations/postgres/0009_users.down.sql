@@ -0,0 +1,16 @@
+-- the tags of the same name are merged, a task only has the tags of its owner
+UPDATE task_tags SET tag_id = (SELECT MIN(same.id) FROM tags JOIN tags same ON same.name = tags.name WHERE tags.id = task_tags.tag_id);
+
+DELETE FROM tags WHERE id NOT IN (SELECT MIN(id) FROM tags GROUP BY name);
+
+ALTER TABLE tags DROP CONSTRAINT tags_owner_id_name_key;
+
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name);
+
+ALTER TABLE tags DROP COLUMN owner_id;
+
+DROP INDEX idx_owner_date;
+
+ALTER TABLE scheduler DROP COLUMN owner_id;
+
+DROP TABLE users;
@@ -0,0 +1,22 @@
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	login TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL DEFAULT '',
+	admin INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+-- the admin account owns the tasks made before the accounts,
+-- its password is set from TODO_PASSWORD when the server starts
+INSERT INTO users (login, admin, created_at) VALUES ('admin', 1, to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'));
+
+ALTER TABLE scheduler ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX idx_owner_date ON scheduler (owner_id, date);
+
+-- every user has their own tag names
+ALTER TABLE tags ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE tags DROP CONSTRAINT tags_name_key;
+
+ALTER TABLE tags ADD CONSTRAINT tags_owner_id_name_key UNIQUE (owner_id, name);
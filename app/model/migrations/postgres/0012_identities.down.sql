@@ -0,0 +1,2 @@
+DROP INDEX idx_identities_user;
+DROP TABLE identities;
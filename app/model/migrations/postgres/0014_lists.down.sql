@@ -0,0 +1,7 @@
+-- the tasks of the lists become private tasks of their owners
+DROP INDEX idx_list_date;
+ALTER TABLE scheduler DROP COLUMN list_id;
+DROP INDEX idx_list_members_user;
+DROP TABLE list_members;
+DROP INDEX idx_lists_owner;
+DROP TABLE lists;
@@ -0,0 +1,25 @@
+-- the lists share their tasks with their members, the tasks without a list (0)
+-- stay private to their owner
+CREATE TABLE lists (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	owner_id INTEGER NOT NULL,
+	-- the permission of all the accounts, '' when only the members see the list
+	everyone TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_lists_owner ON lists (owner_id);
+
+CREATE TABLE list_members (
+	list_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX idx_list_members_user ON list_members (user_id);
+
+ALTER TABLE scheduler ADD COLUMN list_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_list_date ON scheduler (list_id, date);
@@ -0,0 +1,2 @@
+-- the tokens signed with an older version of the account are no longer valid
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS scheduler (
+	id INTEGER PRIMARY KEY,
+	date TEXT,
+	title TEXT,
+	comment TEXT,
+	repeat TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_date ON scheduler (date);
@@ -0,0 +1,4 @@
+DROP INDEX idx_completions_task;
+DROP TABLE task_completions;
+DELETE FROM scheduler WHERE archived = 1;
+ALTER TABLE scheduler DROP COLUMN archived;
@@ -0,0 +1,10 @@
+ALTER TABLE scheduler ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE task_completions (
+	id INTEGER PRIMARY KEY,
+	task_id INTEGER NOT NULL,
+	date TEXT NOT NULL,
+	completed_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_completions_task ON task_completions (task_id);
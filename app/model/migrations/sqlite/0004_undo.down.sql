@@ -0,0 +1,4 @@
+DROP TABLE task_operations;
+DELETE FROM scheduler WHERE deleted = 1;
+DROP TRIGGER scheduler_delete_completions;
+ALTER TABLE scheduler DROP COLUMN deleted;
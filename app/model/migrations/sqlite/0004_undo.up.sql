@@ -0,0 +1,17 @@
+ALTER TABLE scheduler ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+
+-- seq keeps the order the operations were made in
+CREATE TABLE task_operations (
+	seq INTEGER PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	task_id INTEGER NOT NULL,
+	snapshot TEXT NOT NULL,
+	completion_id INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+-- SQLite reuses the id of the last task once it is purged, so its completions
+-- are removed with it instead of passing to a new task
+CREATE TRIGGER scheduler_delete_completions AFTER DELETE ON scheduler BEGIN
+	DELETE FROM task_completions WHERE task_id = old.id;
+END;
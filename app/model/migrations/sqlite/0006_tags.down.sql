@@ -0,0 +1,4 @@
+DROP TRIGGER scheduler_delete_tags;
+DROP INDEX idx_task_tags_tag;
+DROP TABLE task_tags;
+DROP TABLE tags;
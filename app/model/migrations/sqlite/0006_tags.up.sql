@@ -0,0 +1,17 @@
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE task_tags (
+	task_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (task_id, tag_id)
+);
+
+CREATE INDEX idx_task_tags_tag ON task_tags (tag_id);
+
+-- the links of a purged task are removed with it, SQLite reuses its id
+CREATE TRIGGER scheduler_delete_tags AFTER DELETE ON scheduler BEGIN
+	DELETE FROM task_tags WHERE task_id = old.id;
+END;
@@ -0,0 +1,2 @@
+ALTER TABLE scheduler ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduler ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE scheduler DROP COLUMN timezone;
+ALTER TABLE scheduler DROP COLUMN duration;
+ALTER TABLE scheduler DROP COLUMN start_time;
@@ -0,0 +1,3 @@
+ALTER TABLE scheduler ADD COLUMN start_time TEXT NOT NULL DEFAULT '';
+ALTER TABLE scheduler ADD COLUMN duration INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduler ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,19 @@
+-- the tags of the same name are merged, a task only has the tags of its owner
+CREATE TABLE tags_shared (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+INSERT INTO tags_shared (id, name) SELECT MIN(id), name FROM tags GROUP BY name;
+
+UPDATE task_tags SET tag_id = (SELECT tags_shared.id FROM tags JOIN tags_shared ON tags_shared.name = tags.name WHERE tags.id = task_tags.tag_id);
+
+DROP TABLE tags;
+
+ALTER TABLE tags_shared RENAME TO tags;
+
+DROP INDEX idx_owner_date;
+
+ALTER TABLE scheduler DROP COLUMN owner_id;
+
+DROP TABLE users;
@@ -0,0 +1,29 @@
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	login TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL DEFAULT '',
+	admin INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+-- the admin account owns the tasks made before the accounts,
+-- its password is set from TODO_PASSWORD when the server starts
+INSERT INTO users (id, login, admin, created_at) VALUES (1, 'admin', 1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+
+ALTER TABLE scheduler ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX idx_owner_date ON scheduler (owner_id, date);
+
+-- every user has their own tag names
+CREATE TABLE tags_owned (
+	id INTEGER PRIMARY KEY,
+	owner_id INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	UNIQUE (owner_id, name)
+);
+
+INSERT INTO tags_owned (id, name) SELECT id, name FROM tags;
+
+DROP TABLE tags;
+
+ALTER TABLE tags_owned RENAME TO tags;
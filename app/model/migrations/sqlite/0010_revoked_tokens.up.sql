@@ -0,0 +1,5 @@
+-- the tokens revoked by signing out, they are kept until they expire
+CREATE TABLE revoked_tokens (
+	id TEXT PRIMARY KEY,
+	expires_at TEXT NOT NULL
+);
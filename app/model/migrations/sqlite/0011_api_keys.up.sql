@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY,
+	owner_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	-- the key is only known to its owner, the hash finds it
+	key_hash TEXT NOT NULL UNIQUE,
+	prefix TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_api_keys_owner ON api_keys (owner_id);
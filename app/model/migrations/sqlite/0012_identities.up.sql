@@ -0,0 +1,10 @@
+-- the accounts signed in with an OpenID Connect provider, by the subject of its ID tokens
+CREATE TABLE identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_identities_user ON identities (user_id);
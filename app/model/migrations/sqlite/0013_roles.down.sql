@@ -0,0 +1,6 @@
+-- the viewers become users without admin rights
+ALTER TABLE users ADD COLUMN admin INTEGER NOT NULL DEFAULT 0;
+
+UPDATE users SET admin = 1 WHERE role = 'admin';
+
+ALTER TABLE users DROP COLUMN role;
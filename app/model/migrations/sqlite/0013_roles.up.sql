@@ -0,0 +1,6 @@
+-- the admin flag becomes a role: viewer, editor or admin
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'editor';
+
+UPDATE users SET role = 'admin' WHERE admin = 1;
+
+ALTER TABLE users DROP COLUMN admin;
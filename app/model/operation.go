@@ -0,0 +1,140 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// DefUndoWindow is how long a done or delete operation can be undone by default.
+const DefUndoWindow = 5 * time.Minute
+
+// UndoWindow is how long a done or delete operation can be undone.
+var UndoWindow = DefUndoWindow
+
+// Operation is a done or delete call that can be undone.
+// Snapshot is the task as it was before the call.
+type Operation struct {
+	ID           string
+	TaskID       string
+	Snapshot     Task
+	CompletionID int64
+	CreatedAt    time.Time
+}
+
+func newOperationID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func insertOperation(c conn, prev Task, completionID int64) (Operation, error) {
+	id, err := newOperationID()
+	if err != nil {
+		return Operation{}, err
+	}
+	snapshot, err := json.Marshal(prev)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	op := Operation{
+		ID:           id,
+		TaskID:       prev.ID,
+		Snapshot:     prev,
+		CompletionID: completionID,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	_, err = c.Exec(`INSERT INTO task_operations (id, task_id, snapshot, completion_id, created_at) VALUES (:id, :task_id, :snapshot, :completion_id, :created_at)`,
+		sql.Named("id", op.ID),
+		sql.Named("task_id", op.TaskID),
+		sql.Named("snapshot", string(snapshot)),
+		sql.Named("completion_id", op.CompletionID),
+		sql.Named("created_at", op.CreatedAt.Format(time.RFC3339)))
+	return op, err
+}
+
+// UndoOperation restores the task to its state before the operation.
+// Only the latest operation of a task made after since can be undone,
+// otherwise sql.ErrNoRows is returned.
+func (s Db) UndoOperation(id string, since time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	c := s.withTx(tx)
+
+	var op Operation
+	var snapshot string
+	err = c.QueryRow(`SELECT o.task_id, o.snapshot, o.completion_id FROM task_operations o
+		WHERE o.id = :id AND o.created_at >= :since
+		AND o.task_id IN (SELECT id FROM scheduler WHERE `+writableTask+`)
+		AND NOT EXISTS (SELECT 1 FROM task_operations n WHERE n.task_id = o.task_id AND n.seq > o.seq)`,
+		sql.Named("id", id),
+		sql.Named("owner", s.owner),
+		sql.Named("since", since.UTC().Format(time.RFC3339))).Scan(&op.TaskID, &snapshot, &op.CompletionID)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(snapshot), &op.Snapshot); err != nil {
+		return err
+	}
+
+	task := op.Snapshot
+	_, err = c.Exec(`UPDATE scheduler SET date = :date, title = :title, comment = :comment, repeat = :repeat, repeat_until = :repeat_until, repeat_count = :repeat_count, start_time = :start_time, duration = :duration, timezone = :timezone, priority = :priority, position = :position, archived = 0, deleted = 0 WHERE id = :id AND `+writableTask,
+		sql.Named("id", op.TaskID),
+		sql.Named("owner", s.owner),
+		sql.Named("date", task.Date),
+		sql.Named("title", task.Title),
+		sql.Named("comment", task.Comment),
+		sql.Named("repeat", task.Repeat),
+		sql.Named("repeat_until", task.RepeatUntil),
+		sql.Named("repeat_count", task.RepeatCount),
+		sql.Named("start_time", task.Time),
+		sql.Named("duration", task.Duration),
+		sql.Named("timezone", task.TimeZone),
+		sql.Named("priority", task.Priority),
+		sql.Named("position", task.Position))
+	if err != nil {
+		return err
+	}
+
+	if op.CompletionID > 0 {
+		_, err = c.Exec(`DELETE FROM task_completions WHERE id = :id`, sql.Named("id", op.CompletionID))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.Exec(`DELETE FROM task_operations WHERE id = :id`, sql.Named("id", id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeOperations forgets operations made before the given time
+// and removes deleted tasks that can no longer be restored, of all the owners.
+func (s Db) PurgeOperations(before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	c := s.withTx(tx)
+
+	_, err = c.Exec(`DELETE FROM task_operations WHERE created_at < :before`, sql.Named("before", before.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec(`DELETE FROM scheduler WHERE deleted = 1 AND id NOT IN (SELECT task_id FROM task_operations)`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
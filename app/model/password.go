@@ -0,0 +1,104 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The argon2id parameters of HashPasswordArgon2id, the second recommended option of RFC 9106.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errUnknownHash = errors.New("the password hash must be a bcrypt or an argon2id one")
+
+// dummyHash is checked against for the accounts without a password.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("no password can match it")
+	return hash
+})
+
+// HashPasswordArgon2id returns the argon2id hash of the password in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func HashPasswordArgon2id(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPasswordHash checks that the hash is a bcrypt or an argon2id one that can be checked against.
+func CheckPasswordHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, _, err := parseArgon2id(hash)
+		return err
+	}
+	if strings.HasPrefix(hash, "$2") {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	}
+	return errUnknownHash
+}
+
+// checkPasswordHash reports whether the password has the hash, the keys are compared
+// in constant time.
+func checkPasswordHash(hash string, password string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	params, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+}
+
+// parseArgon2id returns the parameters and the key of an argon2id hash in the PHC string format.
+func parseArgon2id(hash string) (argon2Params, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil ||
+		params.memory == 0 || params.time == 0 || params.threads == 0 {
+		return params, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	params.salt = salt
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, errors.New("invalid argon2id key")
+	}
+	return params, key, nil
+}
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Fields of a search query.
+const (
+	FieldText    = ""
+	FieldTitle   = "title"
+	FieldComment = "comment"
+	FieldRepeat  = "repeat"
+	FieldDate    = "date"
+	FieldTag     = "tag"
+)
+
+// queryFields are the fields a search query term can name.
+var queryFields = []string{FieldTitle, FieldComment, FieldRepeat, FieldDate, FieldTag}
+
+// Values of the repeat field besides a rule or its beginning.
+const (
+	RepeatAny  = "any"
+	RepeatNone = "none"
+)
+
+// Condition is a term of a search query that every task must satisfy,
+// or must not satisfy when it is negated.
+type Condition struct {
+	Field string
+	// Op compares dates: =, <, <=, > or >=. The other fields only use =.
+	Op     string
+	Value  string
+	Negate bool
+}
+
+// Query is a parsed search query such as
+//
+//	title:отчёт repeat:any date:>=20261001 -comment:draft tag:work "горячая вода"
+//
+// Words without a field are a text search of the title and the comment, so is a word
+// such as "http://example.com" or "note:" whose prefix is not a known field.
+// A value with spaces is written in double quotes, a leading "-" negates a term.
+type Query struct {
+	// Text is the full-text search made of the words without a field.
+	Text       string
+	Conditions []Condition
+}
+
+// ParseQuery parses a search query.
+func ParseQuery(s string) (Query, error) {
+	var q Query
+	var text []string
+	p := queryParser{input: []rune(s)}
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+
+		var c Condition
+		if p.peek() == '-' {
+			c.Negate = true
+			p.pos++
+		}
+		c.Field = p.field()
+		value, quoted, err := p.value()
+		if err != nil {
+			return Query{}, err
+		}
+		if len(value) == 0 {
+			if c.Field == FieldText {
+				return Query{}, errors.New("empty search term")
+			}
+			return Query{}, fmt.Errorf("value is missing for %q", c.Field)
+		}
+
+		if err := c.set(value); err != nil {
+			return Query{}, err
+		}
+		if c.Field == FieldText && !c.Negate {
+			if quoted {
+				value = `"` + value + `"`
+			}
+			text = append(text, value)
+			continue
+		}
+		q.Conditions = append(q.Conditions, c)
+	}
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// set checks the value for the field of the condition.
+func (c *Condition) set(value string) error {
+	c.Op = "="
+	switch c.Field {
+	case FieldText, FieldTitle, FieldComment, FieldRepeat:
+		c.Value = value
+	case FieldTag:
+		name, err := NormalizeTag(value)
+		if err != nil {
+			return err
+		}
+		c.Value = name
+	case FieldDate:
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				c.Op, value = op, strings.TrimPrefix(value, op)
+				break
+			}
+		}
+		date, err := time.Parse(DateFormat, value)
+		if err != nil {
+			if date, err = time.Parse(SearchDateFormat, value); err != nil {
+				return fmt.Errorf("invalid date %q", value)
+			}
+		}
+		c.Value = date.Format(DateFormat)
+	default:
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+	return nil
+}
+
+// Match reports whether the task satisfies the condition, it is used by the stores
+// that can not compile the query to SQL.
+func (c Condition) Match(task Task) bool {
+	var ok bool
+	switch c.Field {
+	case FieldText:
+		ok = containsFold(task.Title, c.Value) || containsFold(task.Comment, c.Value)
+	case FieldTitle:
+		ok = containsFold(task.Title, c.Value)
+	case FieldComment:
+		ok = containsFold(task.Comment, c.Value)
+	case FieldRepeat:
+		switch c.Value {
+		case RepeatAny:
+			ok = len(task.Repeat) > 0
+		case RepeatNone:
+			ok = len(task.Repeat) == 0
+		default:
+			if c.fullRule() {
+				ok = task.Repeat == c.Value
+			} else {
+				ok = strings.HasPrefix(task.Repeat, c.Value)
+			}
+		}
+	case FieldTag:
+		ok = slices.Contains(task.Tags, c.Value)
+	case FieldDate:
+		switch c.Op {
+		case "=":
+			ok = task.Date == c.Value
+		case "<":
+			ok = task.Date < c.Value
+		case "<=":
+			ok = task.Date <= c.Value
+		case ">":
+			ok = task.Date > c.Value
+		case ">=":
+			ok = task.Date >= c.Value
+		}
+	}
+	return ok != c.Negate
+}
+
+// fullRule reports whether a repeat value is a whole rule such as "d 7",
+// otherwise it is the beginning of a rule such as "w" or "FREQ=WEEKLY".
+func (c Condition) fullRule() bool {
+	return strings.IndexFunc(c.Value, unicode.IsSpace) >= 0
+}
+
+func (c Condition) String() string {
+	var b strings.Builder
+	if c.Negate {
+		b.WriteString("-")
+	}
+	if c.Field != FieldText {
+		b.WriteString(c.Field + ":")
+	}
+	if c.Field == FieldDate && c.Op != "=" {
+		b.WriteString(c.Op)
+	}
+	b.WriteString(quoteValue(c.Value))
+	return b.String()
+}
+
+// String returns the query in a canonical form that can be saved and parsed again.
+func (q Query) String() string {
+	var terms []string
+	for _, c := range q.Conditions {
+		terms = append(terms, c.String())
+	}
+	if len(q.Text) > 0 {
+		terms = append(terms, q.Text)
+	}
+	return strings.Join(terms, " ")
+}
+
+func quoteValue(value string) string {
+	if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type queryParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *queryParser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// field reads the name of a known field followed by a colon, it returns FieldText
+// if there is none and leaves any other name to be read as a part of the text.
+func (p *queryParser) field() string {
+	end := p.pos
+	for end < len(p.input) && unicode.IsLetter(p.input[end]) && p.input[end] < unicode.MaxASCII {
+		end++
+	}
+	if end == p.pos || end >= len(p.input) || p.input[end] != ':' {
+		return FieldText
+	}
+	field := strings.ToLower(string(p.input[p.pos:end]))
+	if !slices.Contains(queryFields, field) {
+		return FieldText
+	}
+	p.pos = end + 1
+	return field
+}
+
+// value reads a word or a text in double quotes.
+func (p *queryParser) value() (string, bool, error) {
+	if p.peek() == '"' {
+		p.pos++
+		start := p.pos
+		for !p.done() && p.peek() != '"' {
+			p.pos++
+		}
+		if p.done() {
+			return "", true, errors.New("closing quote is missing")
+		}
+		value := string(p.input[start:p.pos])
+		p.pos++
+		return strings.TrimSpace(value), true, nil
+	}
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos]), false, nil
+}
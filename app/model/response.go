@@ -10,4 +10,34 @@ type IdResponse struct {
 
 type TaskResponse struct {
 	Tasks []Task `json:"tasks"`
+	Total int    `json:"total"`
+	Next  string `json:"next,omitempty"`
+	// Query is the search query in its canonical form, for saving it as a bookmark.
+	Query string `json:"query,omitempty"`
+	// Truncated is set when a date range has too many tasks to expand them all.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type DatesResponse struct {
+	Dates []string `json:"dates"`
+}
+
+type CompletionsResponse struct {
+	Completions []Completion `json:"completions"`
+}
+
+type TagsResponse struct {
+	Tags []Tag `json:"tags"`
+}
+
+type UsersResponse struct {
+	Users []User `json:"users"`
+}
+
+type APIKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+type ListsResponse struct {
+	Lists []List `json:"lists"`
 }
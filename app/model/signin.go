@@ -1,9 +1,14 @@
 package model
 
 type Sign struct {
+	// Login is empty for the admin account, the web app only asks for the password.
+	Login    string `json:"login,omitempty"`
 	Password string `json:"password"`
 }
 
+// AuthToken is the response of a sign in. The token goes in the token cookie,
+// the refresh token gets a new pair of tokens when the token expires.
 type AuthToken struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
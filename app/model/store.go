@@ -0,0 +1,100 @@
+package model
+
+import "time"
+
+// TaskStore keeps the accounts and, for each of them, the tasks, their tags, completions
+// and the operations that can be undone.
+// Get and Delete methods return sql.ErrNoRows when the task does not exist.
+type TaskStore interface {
+	UserStore
+	TokenStore
+	APIKeyStore
+	IdentityStore
+	ListStore
+	// ForOwner returns the store of the tasks and the tags of the user, the task and tag
+	// methods of a store only see those of its owner.
+	ForOwner(id int) TaskStore
+
+	InsertTask(task Task) (int, error)
+	GetTask(id int) (Task, error)
+	UpdateTask(task Task) (int64, error)
+	DeleteTask(id int) (Operation, error)
+	// ReorderTasks sets the position of the tasks to their index in ids,
+	// it returns sql.ErrNoRows and changes nothing when a task does not exist.
+	ReorderTasks(ids []int) error
+
+	// ListTasks returns a page of the tasks matching the filter, the filter must be checked.
+	ListTasks(filter TaskFilter) (TaskPage, error)
+	// ListTasksInRange returns the tasks that may occur between filter.From and filter.To:
+	// the tasks dated in the range and the repeating tasks dated before its end.
+	// They are ordered by date and id, and there are at most MaxRangeTasks+1 of them
+	// so that the caller can tell when the limit cut the list.
+	ListTasksInRange(filter TaskFilter) ([]Task, error)
+
+	CompleteTask(task Task, date string, archive bool) (Operation, error)
+	GetCompletions(taskID int) ([]Completion, error)
+
+	ListTags() ([]Tag, error)
+	InsertTag(tag Tag) (int, error)
+	UpdateTag(tag Tag) (int64, error)
+	DeleteTag(id int) (int64, error)
+
+	UndoOperation(id string, since time.Time) error
+	PurgeOperations(before time.Time) error
+
+	Close() error
+}
+
+// UserStore keeps the accounts. GetUser and GetUserByLogin return sql.ErrNoRows
+// when the account does not exist.
+type UserStore interface {
+	ListUsers() ([]User, error)
+	GetUser(id int) (User, error)
+	GetUserByLogin(login string) (User, error)
+	InsertUser(user User) (int, error)
+	UpdateUser(user User) (int64, error)
+	DeleteUser(id int) (int64, error)
+}
+
+// TokenStore keeps the denylist of the revoked tokens.
+type TokenStore interface {
+	RevokeToken(id string, expiresAt time.Time) error
+	TokenRevoked(id string) (bool, error)
+}
+
+// APIKeyStore keeps the API keys, the methods other than UseAPIKey only see the keys
+// of the owner of the store.
+type APIKeyStore interface {
+	ListAPIKeys() ([]APIKey, error)
+	InsertAPIKey(key APIKey) (int, error)
+	DeleteAPIKey(id int) (int64, error)
+	// UseAPIKey returns sql.ErrNoRows when no key has the hash.
+	UseAPIKey(hash string) (APIKey, error)
+}
+
+// ListStore keeps the lists of tasks. The owner of the store sees the lists it is
+// a member of, or that are shared with everyone, and changes the ones it manages.
+// GetList returns sql.ErrNoRows when the list is not seen.
+type ListStore interface {
+	ListLists() ([]List, error)
+	GetList(id int) (List, error)
+	InsertList(list List) (int, error)
+	UpdateList(list List) (int64, error)
+	DeleteList(id int) (int64, error)
+	// MoveTask returns sql.ErrNoRows when the task or the list can not be changed.
+	MoveTask(id int, listID int) error
+}
+
+// IdentityStore links the accounts to the subjects of the ID tokens of an OpenID Connect provider.
+type IdentityStore interface {
+	// IdentityUser returns sql.ErrNoRows when no account is linked to the subject.
+	IdentityUser(issuer, subject string) (User, error)
+	// InsertIdentityUser adds an account linked to the subject,
+	// it returns ErrUserExists if the login is taken.
+	InsertIdentityUser(user User, issuer, subject string) (int, error)
+}
+
+var (
+	_ TaskStore = Db{}
+	_ TaskStore = (*MemoryStore)(nil)
+)
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxTagName  = 32
+	MaxTaskTags = 20
+)
+
+var ErrTagExists = errors.New("tag already exists")
+
+// Tag labels tasks, a task may have several tags and a tag may be on many tasks.
+type Tag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// NormalizeTag returns the tag name in lower case and checks it.
+// A name is a single word, so it can be used in a search query.
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return "", errors.New("tag name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxTagName {
+		return "", fmt.Errorf("tag name must not be longer than %d characters", MaxTagName)
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == ',' || r == '"' }) >= 0 {
+		return "", fmt.Errorf("invalid tag name %q", name)
+	}
+	return name, nil
+}
+
+// CheckCorrectData normalizes the tag name.
+func (t *Tag) CheckCorrectData() error {
+	name, err := NormalizeTag(t.Name)
+	if err != nil {
+		return err
+	}
+	t.Name = name
+	return nil
+}
+
+// normalizeTags normalizes the tags of a task, sorts them and drops the duplicates.
+// A nil list stays nil, it keeps the tags of an updated task.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	list := make([]string, 0, len(tags))
+	for _, v := range tags {
+		name, err := NormalizeTag(v)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	if len(list) > MaxTaskTags {
+		return nil, fmt.Errorf("a task can not have more than %d tags", MaxTaskTags)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (s Db) ListTags() ([]Tag, error) {
+	rows, err := s.conn().Query(`SELECT id, name FROM tags WHERE owner_id = :owner ORDER BY name`, sql.Named("owner", s.owner))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]Tag, 0)
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// InsertTag adds a tag, it returns ErrTagExists if the name is taken.
+func (s Db) InsertTag(tag Tag) (int, error) {
+	var id int
+	err := s.inTx(func(c conn) error {
+		if err := s.checkTagName(c, tag); err != nil {
+			return err
+		}
+		return c.QueryRow(`INSERT INTO tags (owner_id, name) VALUES (:owner, :name) RETURNING id`,
+			sql.Named("owner", s.owner), sql.Named("name", tag.Name)).Scan(&id)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateTag renames a tag on all its tasks, it returns ErrTagExists if the name is taken.
+func (s Db) UpdateTag(tag Tag) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		if err := s.checkTagName(c, tag); err != nil {
+			return err
+		}
+		res, err := c.Exec(`UPDATE tags SET name = :name WHERE id = :id AND owner_id = :owner`,
+			sql.Named("name", tag.Name), sql.Named("id", tag.ID), sql.Named("owner", s.owner))
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// DeleteTag removes a tag from all its tasks and deletes it.
+func (s Db) DeleteTag(id int) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		owner := sql.Named("owner", s.owner)
+		_, err := c.Exec(`DELETE FROM task_tags WHERE tag_id = :id AND tag_id IN (SELECT id FROM tags WHERE owner_id = :owner)`, sql.Named("id", id), owner)
+		if err != nil {
+			return err
+		}
+		res, err := c.Exec(`DELETE FROM tags WHERE id = :id AND owner_id = :owner`, sql.Named("id", id), owner)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// checkTagName returns ErrTagExists if another tag of the owner has the name.
+func (s Db) checkTagName(c conn, tag Tag) error {
+	var id string
+	err := c.QueryRow(`SELECT id FROM tags WHERE name = :name AND owner_id = :owner`,
+		sql.Named("name", tag.Name), sql.Named("owner", s.owner)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && id == tag.ID {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrTagExists
+}
+
+// setTaskTags replaces the tags of a task, the tags that the owner does not have yet are created.
+// A nil list keeps the tags.
+func (s Db) setTaskTags(c conn, taskID any, names []string) error {
+	if names == nil {
+		return nil
+	}
+	if _, err := c.Exec(`DELETE FROM task_tags WHERE task_id = :task_id`, sql.Named("task_id", taskID)); err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err := c.Exec(`INSERT INTO tags (owner_id, name) VALUES (:owner, :name) ON CONFLICT (owner_id, name) DO NOTHING`,
+			sql.Named("owner", s.owner), sql.Named("name", name))
+		if err != nil {
+			return err
+		}
+		_, err = c.Exec(`INSERT INTO task_tags (task_id, tag_id) SELECT CAST(:task_id AS INTEGER), id FROM tags WHERE name = :name AND owner_id = :owner`,
+			sql.Named("task_id", taskID), sql.Named("name", name), sql.Named("owner", s.owner))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags fills in the tags of the tasks.
+func loadTags(c conn, tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	byID := make(map[int]*Task, len(tasks))
+	params := make([]string, len(tasks))
+	args := make([]any, len(tasks))
+	for i := range tasks {
+		id, err := strconv.Atoi(tasks[i].ID)
+		if err != nil {
+			return err
+		}
+		byID[id] = &tasks[i]
+		params[i] = fmt.Sprintf(":t%d", i)
+		args[i] = sql.Named(fmt.Sprintf("t%d", i), id)
+	}
+
+	rows, err := c.Query(`SELECT task_tags.task_id, tags.name FROM task_tags JOIN tags ON tags.id = task_tags.tag_id
+		WHERE task_tags.task_id IN (`+strings.Join(params, ", ")+`) ORDER BY tags.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if task, ok := byID[id]; ok {
+			task.Tags = append(task.Tags, name)
+		}
+	}
+	return rows.Err()
+}
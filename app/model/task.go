@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ag89201/go_final_project/app/domain"
@@ -11,6 +12,12 @@ const (
 	DateFormat       = "20060102"
 	SearchDateFormat = "02.01.2006"
 	LimitTask        = 50
+	MaxNextDates     = 100
+	// MaxPriority is the highest priority, 0 is the default.
+	MaxPriority = 3
+	TimeFormat  = domain.TimeFormat
+	// MaxDuration is the longest duration of a task in minutes.
+	MaxDuration = 24 * 60
 )
 
 type Task struct {
@@ -19,6 +26,37 @@ type Task struct {
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	// RepeatUntil is the last date a repeating task may be scheduled on, empty means no limit.
+	RepeatUntil string `json:"repeat_until,omitempty"`
+	// RepeatCount is the number of occurrences left including the current one, 0 means no limit.
+	RepeatCount int `json:"repeat_count,omitempty"`
+	// Time is the start time of the task in TimeFormat, empty means the task has no time.
+	Time string `json:"time,omitempty"`
+	// Duration is the length of the task in minutes, it requires a time.
+	Duration int `json:"duration,omitempty"`
+	// TimeZone is the IANA time zone of the time, empty means the zone of the server.
+	TimeZone string `json:"timezone,omitempty"`
+	// Priority is 0 to MaxPriority, higher comes first within a day.
+	Priority int `json:"priority,omitempty"`
+	// Position is the manual order within a day and a priority, set by reordering the tasks.
+	Position int `json:"position,omitempty"`
+	// ListID is the list of the task, 0 means a private task of its owner.
+	// It is set when the task is created and changed by moving the task.
+	ListID int `json:"list_id,omitempty"`
+	// Tags are the names of the tags of the task. In an update nil keeps the tags
+	// and an empty list removes them.
+	Tags []string `json:"tags,omitempty"`
+	// Snippet is the matching text of a full-text search with the matches in <mark> tags.
+	Snippet string `json:"snippet,omitempty"`
+	// rank is the relevance of a full-text match, lower is better.
+	rank float64
+}
+
+// Completion is a done occurrence of a task.
+type Completion struct {
+	TaskID      string `json:"task_id"`
+	Date        string `json:"date"`
+	CompletedAt string `json:"completed_at"`
 }
 
 func (t *Task) CheckCorrectData() error {
@@ -40,12 +78,95 @@ func (t *Task) CheckCorrectData() error {
 	}
 
 	if len(t.Repeat) > 0 {
-		_, err := domain.GetNextDate(now, t.Date, t.Repeat)
-		if err != nil {
+		if _, err := domain.ParseRepeat(t.Repeat); err != nil {
 			return err
 		}
+	} else if len(t.RepeatUntil) > 0 || t.RepeatCount != 0 {
+		return errors.New("repeat limits require repeat")
+	}
+
+	if len(t.RepeatUntil) > 0 {
+		if _, err := time.Parse(DateFormat, t.RepeatUntil); err != nil {
+			return errors.New("invalid repeat_until format")
+		}
+		if t.RepeatUntil < t.Date {
+			return errors.New("repeat_until is before date")
+		}
+	}
+
+	if t.RepeatCount < 0 {
+		return errors.New("repeat_count must not be negative")
+	}
+
+	if len(t.Time) > 0 {
+		clock, err := time.Parse(TimeFormat, t.Time)
+		if err != nil {
+			return errors.New("invalid time format")
+		}
+		t.Time = clock.Format(TimeFormat)
+	} else if t.Duration != 0 || len(t.TimeZone) > 0 {
+		return errors.New("duration and timezone require time")
+	}
+
+	if t.Duration < 0 || t.Duration > MaxDuration {
+		return fmt.Errorf("duration must be between 0 and %d minutes", MaxDuration)
+	}
+
+	if len(t.TimeZone) > 0 {
+		if _, err := time.LoadLocation(t.TimeZone); err != nil {
+			return fmt.Errorf("unknown timezone %q", t.TimeZone)
+		}
+	}
 
+	if t.Priority < 0 || t.Priority > MaxPriority {
+		return fmt.Errorf("priority must be between 0 and %d", MaxPriority)
 	}
 
+	if t.Position < 0 {
+		return errors.New("position must not be negative")
+	}
+
+	if t.Tags, err = normalizeTags(t.Tags); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NextOccurrence moves a repeating task to its next date when the current one is done.
+// A task with a time moves to the first day whose time has not passed yet in its time zone.
+// It returns domain.ErrSeriesEnded when the task has no occurrences left.
+func (t *Task) NextOccurrence(now time.Time) error {
+	return t.advance(now, t.at())
+}
+
+// at returns the time of day of the task for the domain rules.
+func (t Task) at() domain.At {
+	at := domain.At{Time: t.Time}
+	if len(t.TimeZone) > 0 {
+		// the zone was checked when the task was saved
+		at.Location, _ = time.LoadLocation(t.TimeZone)
+	}
+	return at
+}
+
+// advance moves the task to its next date after now.
+func (t *Task) advance(now time.Time, at domain.At) error {
+	if t.RepeatCount == 1 {
+		return domain.ErrSeriesEnded
+	}
+
+	date, repeat, err := domain.AdvanceRepeat(now, t.Date, t.Repeat, at)
+	if err != nil {
+		return err
+	}
+	if len(t.RepeatUntil) > 0 && date > t.RepeatUntil {
+		return domain.ErrSeriesEnded
+	}
+
+	t.Date, t.Repeat = date, repeat
+	if t.RepeatCount > 0 {
+		t.RepeatCount--
+	}
 	return nil
 }
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RevokeToken puts the token id on the denylist until the token expires,
+// the ids of the tokens that have expired are dropped from it.
+func (s Db) RevokeToken(id string, expiresAt time.Time) error {
+	return s.inTx(func(c conn) error {
+		_, err := c.Exec(`DELETE FROM revoked_tokens WHERE expires_at < :now`, sql.Named("now", time.Now().UTC().Format(time.RFC3339)))
+		if err != nil {
+			return err
+		}
+		_, err = c.Exec(`INSERT INTO revoked_tokens (id, expires_at) VALUES (:id, :expires_at) ON CONFLICT (id) DO NOTHING`,
+			sql.Named("id", id), sql.Named("expires_at", expiresAt.UTC().Format(time.RFC3339)))
+		return err
+	})
+}
+
+func (s Db) TokenRevoked(id string) (bool, error) {
+	var n int
+	err := s.conn().QueryRow(`SELECT COUNT(*) FROM revoked_tokens WHERE id = :id`, sql.Named("id", id)).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,317 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AdminID is the account created by the migration, it owns the tasks made before
+	// the accounts and signs in with TODO_PASSWORD or TODO_PASSWORD_HASH.
+	AdminID    = 1
+	AdminLogin = "admin"
+
+	MinLogin    = 3
+	MaxLogin    = 32
+	MinPassword = 8
+	// MaxPassword is the longest password bcrypt can hash, in bytes.
+	MaxPassword = 72
+)
+
+// Roles of the accounts, each role can do what the roles before it can:
+// viewers read the tasks, editors create, edit and complete them,
+// admins delete them and manage the accounts.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+var ErrUserExists = errors.New("login already exists")
+
+// User is an account, it owns its tasks and tags.
+type User struct {
+	ID    string `json:"id"`
+	Login string `json:"login"`
+	// Password is only read from requests, the store keeps PasswordHash.
+	Password string `json:"password,omitempty"`
+	// OldPassword confirms a change of the own password of an account that has one.
+	OldPassword  string `json:"old_password,omitempty"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	CreatedAt    string `json:"created_at,omitempty"`
+	// TokenVersion goes up with every change of the password hash,
+	// the tokens signed with an older version are no longer valid.
+	TokenVersion int `json:"-"`
+}
+
+// NormalizeLogin returns the login in lower case and checks it.
+func NormalizeLogin(login string) (string, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if n := utf8.RuneCountInString(login); n < MinLogin || n > MaxLogin {
+		return "", fmt.Errorf("login must be %d to %d characters long", MinLogin, MaxLogin)
+	}
+	if strings.IndexFunc(login, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_' && r != '-'
+	}) >= 0 {
+		return "", fmt.Errorf("invalid login %q", login)
+	}
+	return login, nil
+}
+
+// CheckCorrectData normalizes the login, checks the role and hashes the password when
+// it is set. A new account must have a password and is an editor without a role,
+// an updated one keeps its hash without a password.
+func (u *User) CheckCorrectData(isNew bool) error {
+	login, err := NormalizeLogin(u.Login)
+	if err != nil {
+		return err
+	}
+	u.Login = login
+
+	if len(u.Role) == 0 && isNew {
+		u.Role = RoleEditor
+	}
+	if _, ok := roleRanks[u.Role]; !ok {
+		return fmt.Errorf("role must be %s, %s or %s", RoleViewer, RoleEditor, RoleAdmin)
+	}
+
+	if len(u.Password) == 0 {
+		if isNew {
+			return errors.New("password is required")
+		}
+		return nil
+	}
+	if err := CheckPasswordLength(u.Password); err != nil {
+		return err
+	}
+	if u.PasswordHash, err = HashPassword(u.Password); err != nil {
+		return err
+	}
+	u.Password = ""
+	return nil
+}
+
+// CheckPasswordLength checks that the password is long enough and that bcrypt can hash it.
+func CheckPasswordLength(password string) error {
+	if utf8.RuneCountInString(password) < MinPassword || len(password) > MaxPassword {
+		return fmt.Errorf("password must be %d to %d characters long", MinPassword, MaxPassword)
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// HasRole reports whether the account has the role or a role that can do more.
+func (u User) HasRole(role string) bool {
+	rank, ok := roleRanks[u.Role]
+	return ok && rank >= roleRanks[role]
+}
+
+// CheckPassword reports whether the password is the one of the account.
+// An account without a password, or the zero User of an unknown login, can not sign in,
+// but the check takes as long as for any other account.
+func (u User) CheckPassword(password string) bool {
+	if len(u.PasswordHash) == 0 {
+		checkPasswordHash(dummyHash(), password)
+		return false
+	}
+	return checkPasswordHash(u.PasswordHash, password)
+}
+
+// SetAdminPassword sets the password of the admin account unless it already has it.
+func SetAdminPassword(users UserStore, password string) error {
+	admin, err := users.GetUser(AdminID)
+	if err != nil {
+		return err
+	}
+	if admin.CheckPassword(password) {
+		return nil
+	}
+	if admin.PasswordHash, err = HashPassword(password); err != nil {
+		return err
+	}
+	_, err = users.UpdateUser(admin)
+	return err
+}
+
+// SetAdminPasswordHash sets the password hash of the admin account,
+// a bcrypt or an argon2id one, unless it already has it.
+func SetAdminPasswordHash(users UserStore, hash string) error {
+	if err := CheckPasswordHash(hash); err != nil {
+		return err
+	}
+	admin, err := users.GetUser(AdminID)
+	if err != nil {
+		return err
+	}
+	if admin.PasswordHash == hash {
+		return nil
+	}
+	admin.PasswordHash = hash
+	_, err = users.UpdateUser(admin)
+	return err
+}
+
+const userColumns = `id, login, password_hash, role, created_at, token_version`
+
+func (u *User) fields() []any {
+	return []any{&u.ID, &u.Login, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.TokenVersion}
+}
+
+func (s Db) ListUsers() ([]User, error) {
+	rows, err := s.conn().Query(`SELECT ` + userColumns + ` FROM users ORDER BY login`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(user.fields()...); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s Db) GetUser(id int) (User, error) {
+	var user User
+	err := s.conn().QueryRow(`SELECT `+userColumns+` FROM users WHERE id = :id`, sql.Named("id", id)).Scan(user.fields()...)
+	return user, err
+}
+
+func (s Db) GetUserByLogin(login string) (User, error) {
+	var user User
+	err := s.conn().QueryRow(`SELECT `+userColumns+` FROM users WHERE login = :login`, sql.Named("login", login)).Scan(user.fields()...)
+	return user, err
+}
+
+// InsertUser adds an account, it returns ErrUserExists if the login is taken.
+func (s Db) InsertUser(user User) (int, error) {
+	var id int
+	err := s.inTx(func(c conn) error {
+		var err error
+		id, err = insertUser(c, user)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func insertUser(c conn, user User) (int, error) {
+	if err := checkLogin(c, user); err != nil {
+		return 0, err
+	}
+	var id int
+	err := c.QueryRow(`INSERT INTO users (login, password_hash, role, created_at) VALUES (:login, :password_hash, :role, :created_at) RETURNING id`,
+		sql.Named("login", user.Login),
+		sql.Named("password_hash", user.PasswordHash),
+		sql.Named("role", user.Role),
+		sql.Named("created_at", time.Now().UTC().Format(time.RFC3339))).Scan(&id)
+	return id, err
+}
+
+// UpdateUser saves the login, the password hash and the role of an account
+// and bumps its token version when the password hash changes,
+// it returns ErrUserExists if the login is taken.
+func (s Db) UpdateUser(user User) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		if err := checkLogin(c, user); err != nil {
+			return err
+		}
+		res, err := c.Exec(`UPDATE users SET login = :login, password_hash = :password_hash, role = :role,
+			token_version = CASE WHEN password_hash = :password_hash THEN token_version ELSE token_version + 1 END WHERE id = :id`,
+			sql.Named("id", user.ID),
+			sql.Named("login", user.Login),
+			sql.Named("password_hash", user.PasswordHash),
+			sql.Named("role", user.Role))
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// DeleteUser deletes an account with its private tasks, tags, API keys and identities.
+// Its tasks in the lists stay there and its lists go to the admin account.
+func (s Db) DeleteUser(id int) (int64, error) {
+	var rowsAffected int64
+	err := s.inTx(func(c conn) error {
+		owner := sql.Named("owner", id)
+		_, err := c.Exec(`DELETE FROM task_operations WHERE task_id IN (SELECT id FROM scheduler WHERE owner_id = :owner AND list_id = 0)`, owner)
+		if err != nil {
+			return err
+		}
+		// the completions and the tag links go with the tasks
+		if _, err = c.Exec(`DELETE FROM scheduler WHERE owner_id = :owner AND list_id = 0`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`DELETE FROM task_tags WHERE tag_id IN (SELECT id FROM tags WHERE owner_id = :owner)`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`DELETE FROM tags WHERE owner_id = :owner`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`DELETE FROM api_keys WHERE owner_id = :owner`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`DELETE FROM identities WHERE user_id = :owner`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`DELETE FROM list_members WHERE user_id = :owner`, owner); err != nil {
+			return err
+		}
+		if _, err = c.Exec(`UPDATE lists SET owner_id = :admin WHERE owner_id = :owner`, owner, sql.Named("admin", AdminID)); err != nil {
+			return err
+		}
+		res, err := c.Exec(`DELETE FROM users WHERE id = :owner`, owner)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// checkLogin returns ErrUserExists if another account has the login.
+func checkLogin(c conn, user User) error {
+	var id string
+	err := c.QueryRow(`SELECT id FROM users WHERE login = :login`, sql.Named("login", user.Login)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && id == user.ID {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrUserExists
+}
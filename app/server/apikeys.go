@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/model"
+)
+
+func (s *Server) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.tasks(r).ListAPIKeys()
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIKeysResponse{Keys: keys})
+}
+
+// PostAPIKeyHandler creates an API key of the account. The key is only in this
+// response, it can not be read again.
+func (s *Server) PostAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var key model.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	if err := key.CheckCorrectData(); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+	if err := key.Generate(); err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	key.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	id, err := s.tasks(r).InsertAPIKey(key)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	key.ID = strconv.Itoa(id)
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// DeleteAPIKeyHandler revokes an API key of the account.
+func (s *Server) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+
+	rowsAffected, err := s.tasks(r).DeleteAPIKey(id)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "key was not found", errors.New("no key with id "+strconv.Itoa(id)))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
@@ -1,36 +1,318 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ag89201/go_final_project/app/model"
 	"github.com/golang-jwt/jwt"
-	log "github.com/sirupsen/logrus"
 )
 
-func Auth(next http.HandlerFunc) http.HandlerFunc {
+const (
+	// DefTokenTTL is how long a token is valid by default, a working day.
+	DefTokenTTL = 8 * time.Hour
+	// DefRefreshTTL is how long a refresh token is valid by default.
+	DefRefreshTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// TokenTTL is how long a token is valid.
+	TokenTTL = DefTokenTTL
+	// RefreshTTL is how long a refresh token is valid.
+	RefreshTTL = DefRefreshTTL
+)
+
+// Types of the tokens, a refresh token can not be used as a token.
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+// tokenClaims are the claims of the tokens: sub is the account id, jti is the id
+// that is put on the denylist when the token is revoked and ver is the token version
+// of the account.
+type tokenClaims struct {
+	jwt.StandardClaims
+	Type    string `json:"type"`
+	Version int    `json:"ver,omitempty"`
+}
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	claimsKey
+	apiKeyKey
+)
+
+// Auth lets the request through when it has a valid API key in the Authorization header
+// or a valid token cookie, and puts the account of the key or the token in the request
+// context. Unless authEnabled the requests without an API key act as the admin account.
+// The requests of a signed in account are limited by AccountRateLimit.
+func (s *Server) Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		pass := os.Getenv("TODO_PASSWORD")
-		if len(pass) > 0 {
+		user := model.User{ID: strconv.Itoa(model.AdminID), Login: model.AdminLogin, Role: model.RoleAdmin}
+		ctx := r.Context()
+		// without authentication everyone is the admin, only the address limit applies
+		handler := next
+		if bearer, ok := strings.CutPrefix(r.Header.Get(authorizationHeader), "Bearer "); ok {
+			key, err := s.store.UseAPIKey(model.HashAPIKey(strings.TrimSpace(bearer)))
+			if err == nil {
+				user, err = s.store.GetUser(key.OwnerID)
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				errorInternalResponse(w, err)
+				return
+			}
+			if key.Scope == model.ScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				forbiddenResponse(w, errors.New("the API key can only read"))
+				return
+			}
+			ctx = context.WithValue(ctx, apiKeyKey, key)
+			handler = s.LimitAccount(next)
+		} else if authEnabled() {
 			var cookieToken string
 			cookie, err := r.Cookie("token")
 			if err == nil {
 				cookieToken = cookie.Value
 			}
-			jwtInstance := jwt.New(jwt.SigningMethodHS256)
-			token, err := jwtInstance.SignedString([]byte(pass))
+			claims, err := s.parseToken(cookieToken, accessToken)
+			if err == nil {
+				user, err = s.tokenUser(claims)
+			}
+			if errors.Is(err, errInvalidToken) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 			if err != nil {
-				log.Fatalf("Error signing token: %v", err)
+				errorInternalResponse(w, err)
 				return
 			}
+			ctx = context.WithValue(ctx, claimsKey, claims)
+			handler = s.LimitAccount(next)
+		}
+		handler(w, r.WithContext(context.WithValue(ctx, userKey, user)))
+	}
+}
 
-			if cookieToken != token {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// authEnabled reports whether the requests must be signed in: the admin account has
+// a password, TODO_PASSWORD or TODO_PASSWORD_HASH, or the users sign in with TODO_OIDC_ISSUER.
+func authEnabled() bool {
+	return len(os.Getenv("TODO_PASSWORD")) > 0 || len(os.Getenv("TODO_PASSWORD_HASH")) > 0 ||
+		len(os.Getenv("TODO_OIDC_ISSUER")) > 0
+}
+
+// RequireRole returns the middleware that lets the request through when it is made by
+// an account with the role or a role that can do more, it goes after Auth.
+func RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !currentUser(r).HasRole(role) {
+				forbiddenResponse(w, fmt.Errorf("the %s role is required", role))
 				return
 			}
+			next(w, r)
+		}
+	}
+}
+
+// SessionOnly rejects the requests made with an API key, so that a key can not
+// create other keys or change the accounts. It goes after Auth.
+func SessionOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiKeyKey).(model.APIKey); ok {
+			forbiddenResponse(w, errors.New("an API key can not be used here"))
+			return
 		}
 		next(w, r)
+	}
+}
+
+func forbiddenResponse(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusForbidden, model.ErrorResponse{Error: err.Error()})
+}
+
+// currentUser returns the account that Auth put in the request context.
+func currentUser(r *http.Request) model.User {
+	user, _ := r.Context().Value(userKey).(model.User)
+	return user
+}
+
+// tasks returns the store of the tasks of the account making the request.
+func (s *Server) tasks(r *http.Request) model.TaskStore {
+	id, _ := strconv.Atoi(currentUser(r).ID)
+	return s.store.ForOwner(id)
+}
 
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// signToken returns a token of the type for the account that expires after ttl.
+func (s *Server) signToken(user model.User, typ string, ttl time.Duration) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			Subject:   user.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Type:    typ,
+		Version: user.TokenVersion,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// errInvalidToken is returned for a token that is malformed, expired, revoked,
+// of another type or of an account that no longer exists or has changed its password.
+var errInvalidToken = errors.New("invalid token")
+
+// parseToken checks the signature, the expiry and the type of the token
+// and that it has not been revoked.
+func (s *Server) parseToken(token string, typ string) (tokenClaims, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return s.secret, nil
+	})
+	if err != nil {
+		return claims, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	if claims.Type != typ || len(claims.Id) == 0 || claims.ExpiresAt == 0 {
+		return claims, errInvalidToken
+	}
+
+	revoked, err := s.store.TokenRevoked(claims.Id)
+	if err != nil {
+		return claims, err
+	}
+	if revoked {
+		return claims, fmt.Errorf("%w: the token has been revoked", errInvalidToken)
+	}
+	return claims, nil
+}
+
+// tokenUser returns the account of the token,
+// it may have been deleted since the token was issued.
+func (s *Server) tokenUser(claims tokenClaims) (model.User, error) {
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return model.User{}, errInvalidToken
+	}
+	user, err := s.store.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, errInvalidToken
+	}
+	if err == nil && claims.Version != user.TokenVersion {
+		return user, errInvalidToken
+	}
+	return user, err
+}
+
+// revokeToken puts the token on the denylist.
+func (s *Server) revokeToken(claims tokenClaims) error {
+	return s.store.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// writeTokens responds with a new token and refresh token of the account.
+func (s *Server) writeTokens(w http.ResponseWriter, user model.User) {
+	var tokens model.AuthToken
+	var err error
+	if tokens.Token, err = s.signToken(user, accessToken, TokenTTL); err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	if tokens.RefreshToken, err = s.signToken(user, refreshToken, RefreshTTL); err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// RefreshHandler exchanges a refresh token for a new pair of tokens. The refresh token
+// is revoked, so a stolen one stops working once its owner has used it.
+func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var body model.AuthToken
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+
+	claims, err := s.parseToken(body.RefreshToken, refreshToken)
+	if err == nil {
+		var user model.User
+		if user, err = s.tokenUser(claims); err == nil {
+			if err = s.revokeToken(claims); err != nil {
+				errorInternalResponse(w, err)
+				return
+			}
+			s.writeTokens(w, user)
+			return
+		}
+	}
+	if errors.Is(err, errInvalidToken) {
+		writeJSON(w, http.StatusUnauthorized, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+	errorInternalResponse(w, err)
+}
+
+// SignoutHandler revokes the token of the request and the refresh token in the body,
+// if there is one, and clears the token cookie.
+func (s *Server) SignoutHandler(w http.ResponseWriter, r *http.Request) {
+	var body model.AuthToken
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+
+	if claims, ok := r.Context().Value(claimsKey).(tokenClaims); ok {
+		if err := s.revokeToken(claims); err != nil {
+			errorInternalResponse(w, err)
+			return
+		}
+	}
+	if len(body.RefreshToken) > 0 {
+		claims, err := s.parseToken(body.RefreshToken, refreshToken)
+		if err != nil && !errors.Is(err, errInvalidToken) {
+			errorInternalResponse(w, err)
+			return
+		}
+		// only the refresh tokens of the same account are revoked
+		if err == nil && claims.Subject == currentUser(r).ID {
+			if err := s.revokeToken(claims); err != nil {
+				errorInternalResponse(w, err)
+				return
+			}
+		}
 	}
 
+	http.SetCookie(w, &http.Cookie{Name: "token", Path: "/", MaxAge: -1})
+	writeJSON(w, http.StatusOK, struct{}{})
 }
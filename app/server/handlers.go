@@ -7,9 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,7 +17,6 @@ import (
 	"github.com/ag89201/go_final_project/app/model"
 
 	"github.com/ag89201/go_final_project/app/domain"
-	"github.com/golang-jwt/jwt"
 )
 
 func errorInternalResponse(w http.ResponseWriter,  err error){
@@ -42,24 +41,85 @@ func errorResponse(w http.ResponseWriter, errMsg string, err error) {
 	}
 }
 
+// writeJSON writes v as the JSON response with the status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, jsonMimeType)
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		errorInternalResponse(nil, err)
+	}
+}
 
-func NextDateHandler(w http.ResponseWriter, r *http.Request) {
+// NextDateHandler returns the next dates of a repeat rule. The time and tz of a task move
+// the first date to the next day once the time has passed in the zone, for that now
+// is a moment in RFC 3339 rather than a date.
+func (s *Server) NextDateHandler(w http.ResponseWriter, r *http.Request) {
 	now, err := time.Parse(model.DateFormat, r.FormValue("now"))
 	if err != nil {
-		errorResponse(w, "error parsing date", err)
-		return
+		if now, err = time.Parse(time.RFC3339, r.FormValue("now")); err != nil {
+			errorResponse(w, "error parsing date", err)
+			return
+		}
+	}
+
+	at := domain.At{Time: r.FormValue("time")}
+	if len(at.Time) > 0 {
+		if _, err := time.Parse(model.TimeFormat, at.Time); err != nil {
+			errorResponse(w, "invalid time", err)
+			return
+		}
+	}
+	if tz := r.FormValue("tz"); len(tz) > 0 {
+		if at.Location, err = time.LoadLocation(tz); err != nil {
+			errorResponse(w, "invalid tz", err)
+			return
+		}
+	}
+
+	count := 1
+	if len(r.FormValue("count")) > 0 {
+		count, err = strconv.Atoi(r.FormValue("count"))
+		if err != nil {
+			errorResponse(w, "invalid count", err)
+			return
+		}
+		if count < 1 || count > model.MaxNextDates {
+			errorResponse(w, "invalid count", fmt.Errorf("count must be between 1 and %d", model.MaxNextDates))
+			return
+		}
 	}
 
 	date := r.FormValue("date")
 	repeat := r.FormValue("repeat")
-	nextDate, err := domain.GetNextDate(now, date, repeat)
+	nextDates, err := domain.GetNextDates(now, date, repeat, count, at)
 
 	if err != nil {
 		errorResponse(w, "error getting next date", err)
 		return
 	}
+
+	if strings.Contains(r.Header.Get(acceptHeader), jsonMediaType) {
+		data, err := json.Marshal(model.DatesResponse{Dates: nextDates})
+		if err != nil {
+			errorInternalResponse(w, err)
+			return
+		}
+		w.Header().Set(contentTypeHeader, jsonMimeType)
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(data)
+		if err != nil {
+			errorInternalResponse(nil, err)
+		}
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(nextDate))
+	_, err = w.Write([]byte(strings.Join(nextDates, "\n")))
 
 	if err != nil {
 		errorInternalResponse(nil, err)
@@ -67,7 +127,7 @@ func NextDateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func PostTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var newTask model.Task
 	var buf bytes.Buffer
 
@@ -86,8 +146,12 @@ func PostTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := model.Database.InsertTask(newTask)
+	id, err := s.tasks(r).InsertTask(newTask)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "list was not found", err)
+			return
+		}
 		errorInternalResponse(w, err)
 		return
 	}
@@ -108,40 +172,99 @@ func PostTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func GetTasksHandler(w http.ResponseWriter, r *http.Request) {
-	var tasks []model.Task
-	search := r.URL.Query().Get("search")
+func (s *Server) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var filter model.TaskFilter
+	query := r.URL.Query()
+	search := query.Get("search")
 
 	if len(search) > 0 {
 		date, err := time.Parse(model.SearchDateFormat, search)
 
 		if err != nil {
-			tasks, err = model.Database.GetTasksByTitleOrComment(search)
-			if err != nil {
-				errorInternalResponse(w,err)
-				return
-			}
+			filter.Search = search
 		} else {
 			// search by date
-			tasks, err = model.Database.GetTasksByDate(date.Format(model.DateFormat))
-			if err != nil {
-				errorInternalResponse(w,err)
-				return
-			}
+			filter.Date = date.Format(model.DateFormat)
 		}
-	} else {
-		var err error
-		if tasks, err = model.Database.GetTasks(); err != nil {
-			errorInternalResponse(w,err)
+	}
+
+	var err error
+	var q model.Query
+	if len(query.Get("q")) > 0 {
+		if len(search) > 0 {
+			errorResponse(w, "invalid query", errors.New("search can not be used with q"))
+			return
+		}
+		if q, err = model.ParseQuery(query.Get("q")); err != nil {
+			errorResponse(w, "invalid query", err)
+			return
+		}
+		filter.Search, filter.Conditions = q.Text, q.Conditions
+	}
+	if filter.Sort, filter.Desc, err = model.ParseSort(query.Get("sort")); err != nil {
+		errorResponse(w, "invalid sort", err)
+		return
+	}
+	if len(query.Get("limit")) > 0 {
+		if filter.Limit, err = strconv.Atoi(query.Get("limit")); err != nil || filter.Limit == 0 {
+			errorResponse(w, "invalid limit", fmt.Errorf("limit must be between 1 and %d", model.MaxLimitTask))
+			return
+		}
+	}
+	if len(query.Get("offset")) > 0 {
+		if filter.Offset, err = strconv.Atoi(query.Get("offset")); err != nil {
+			errorResponse(w, "invalid offset", err)
+			return
+		}
+	}
+	for _, v := range query["tag"] {
+		name, err := model.NormalizeTag(v)
+		if err != nil {
+			errorResponse(w, "invalid tag", err)
+			return
+		}
+		filter.Conditions = append(filter.Conditions, model.Condition{Field: model.FieldTag, Op: "=", Value: name})
+	}
+	filter.From, filter.To = query.Get("from"), query.Get("to")
+	if len(query.Get("list_id")) > 0 {
+		listID, err := strconv.Atoi(query.Get("list_id"))
+		if err != nil || listID < 0 {
+			errorResponse(w, "invalid list_id", errors.New("list_id must be a list id or 0 for the private tasks"))
+			return
+		}
+		filter.ListID = &listID
+	}
+	if len(query.Get("after")) > 0 {
+		if filter.After, err = model.ParseCursor(query.Get("after")); err != nil {
+			errorResponse(w, "invalid after", err)
 			return
 		}
 	}
+	if err := filter.Check(); err != nil {
+		errorResponse(w, "invalid query", err)
+		return
+	}
+
+	var page model.TaskPage
+	if filter.Ranged() {
+		page, err = model.ListAgenda(s.tasks(r), filter)
+	} else {
+		page, err = s.tasks(r).ListTasks(filter)
+	}
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
 
-	if tasks == nil {
-		tasks = make([]model.Task, 0)
+	response := model.TaskResponse{Tasks: page.Tasks, Total: page.Total, Query: q.String(), Truncated: page.Truncated}
+	if response.Tasks == nil {
+		response.Tasks = make([]model.Task, 0)
+	}
+	if page.Next != nil {
+		response.Next = page.Next.String()
 	}
 
-	data, err := json.Marshal(model.TaskResponse{Tasks: tasks})
+	data, err := json.Marshal(response)
 	if err != nil {
 		errorInternalResponse(w,err)
 		return
@@ -158,7 +281,7 @@ func GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get("id"))
 
 	if err != nil {
@@ -166,7 +289,7 @@ func GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := model.Database.GetTask(id)
+	task, err := s.tasks(r).GetTask(id)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -194,7 +317,7 @@ func GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func PutTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var buf bytes.Buffer
 
 	if _, err := buf.ReadFrom(r.Body); err != nil {
@@ -218,7 +341,7 @@ func PutTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rowsAffected, err := model.Database.UpdateTask(task)
+	rowsAffected, err := s.tasks(r).UpdateTask(task)
 	if err != nil {
 	    errorInternalResponse(w,err)
 		return
@@ -244,13 +367,14 @@ func PutTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func PostDoneTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostDoneTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
 		errorResponse(w, "invalid id", err)
+		return
 	}
 
-	task, err := model.Database.GetTask(id)
+	task, err := s.tasks(r).GetTask(id)
 	
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -262,28 +386,29 @@ func PostDoneTaskHandler(w http.ResponseWriter, r *http.Request) {
 		}		
 	
 
-	if len(task.Repeat) == 0 {
-		rows,err := model.Database.DeleteTask(id)
-		if err != nil {
-			errorInternalResponse(w, err)
-			return
-		}
-		if rows == 0 {
-		    errorResponse(w, "task was not found", err)
-			return
-		}
-	} else {
-		task.Date, err = domain.GetNextDate(time.Now(), task.Date, task.Repeat)
-		if err != nil {
+	// a one-off task or a series that has ended is archived
+	scheduled := task.Date
+	finished := len(task.Repeat) == 0
+	if !finished {
+		err = task.NextOccurrence(time.Now())
+		if errors.Is(err, domain.ErrSeriesEnded) {
+			finished = true
+		} else if err != nil {
 			errorResponse(w, "error getting next date", err)
 			return
 		}
 	}
-	_, err = model.Database.UpdateTask(task)
+
+	op, err := s.tasks(r).CompleteTask(task, scheduled, finished)
 	if err != nil {
-		errorResponse(w, "error updating task", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "task was not found", err)
+			return
+		}
+		errorInternalResponse(w, err)
 		return
 	}
+	s.purgeOperations()
 
 	data, err := json.Marshal(struct{}{})
 	if err != nil {
@@ -291,6 +416,7 @@ func PostDoneTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set(contentTypeHeader, jsonMimeType)
+	w.Header().Set(undoHeader, op.ID)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(data)
 	if err != nil {
@@ -300,29 +426,134 @@ func PostDoneTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetTaskHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
 		errorResponse(w, "invalid id", err)
 		return
 	}
 
-	rows,err := model.Database.DeleteTask(id)
+	completions, err := s.tasks(r).GetCompletions(id)
 	if err != nil {
 		errorInternalResponse(w, err)
 		return
 	}
-	if rows == 0 {
-		errorResponse(w, "task was not found", err)
+
+	if completions == nil {
+		completions = make([]model.Completion, 0)
+	}
+
+	data, err := json.Marshal(model.CompletionsResponse{Completions: completions})
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, jsonMimeType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	if err != nil {
+		errorInternalResponse(nil, err)
+		return
+	}
+}
+
+// ReorderTasksHandler sets the manual order of tasks, for example of the tasks of a day
+// after dragging one of them. The body lists the task ids in the new order.
+func (s *Server) ReorderTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	if len(body.IDs) == 0 || len(body.IDs) > model.MaxLimitTask {
+		errorResponse(w, "invalid ids", fmt.Errorf("ids must list 1 to %d tasks", model.MaxLimitTask))
+		return
+	}
+	ids := make([]int, len(body.IDs))
+	seen := make(map[int]bool)
+	for i, v := range body.IDs {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			errorResponse(w, "invalid id", err)
+			return
+		}
+		if seen[id] {
+			errorResponse(w, "invalid ids", fmt.Errorf("task %d is listed twice", id))
+			return
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+
+	if err := s.tasks(r).ReorderTasks(ids); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "task was not found", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
 		return
 	}
 
+	op, err := s.tasks(r).DeleteTask(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "task was not found", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	s.purgeOperations()
+
 	data, err := json.Marshal(struct{}{})
 	if err != nil {
 		errorInternalResponse(w,err)
 		return
 	}
 	w.Header().Set(contentTypeHeader, jsonMimeType)
+	w.Header().Set(undoHeader, op.ID)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	if err != nil {
+		errorInternalResponse(nil, err)
+		return
+	}
+}
+
+func (s *Server) UndoHandler(w http.ResponseWriter, r *http.Request) {
+	op := r.URL.Query().Get("op")
+	if len(op) == 0 {
+		errorResponse(w, "invalid operation", errors.New("op is required"))
+		return
+	}
+
+	err := s.tasks(r).UndoOperation(op, time.Now().Add(-model.UndoWindow))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "operation can not be undone", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+
+	data, err := json.Marshal(struct{}{})
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, jsonMimeType)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(data)
 	if err != nil {
@@ -331,7 +562,17 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func SigninHandler(w http.ResponseWriter, r *http.Request) {
+// purgeOperations drops the operations that can no longer be undone.
+// A failure is only logged, the operation that triggered it has already succeeded.
+func (s *Server) purgeOperations() {
+	if err := s.store.PurgeOperations(time.Now().Add(-model.UndoWindow)); err != nil {
+		errorInternalResponse(nil, err)
+	}
+}
+
+// SigninHandler checks the login and the password of an account and returns its tokens.
+// The request without a login is for the admin account.
+func (s *Server) SigninHandler(w http.ResponseWriter, r *http.Request) {
 
 	var buf bytes.Buffer
 
@@ -346,28 +587,40 @@ func SigninHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	envPass := os.Getenv("TODO_PASSWORD")
-	if signin.Password == envPass {
-		jwtInstance := jwt.New(jwt.SigningMethodHS256)
-		token, err := jwtInstance.SignedString([]byte(envPass))
-		if err != nil {
-			errorResponse(w, "error signing token", err)
-		}
+	if !authEnabled() {
+		errorResponse(w, "sign in is not available", errors.New("authentication is disabled"))
+		return
+	}
 
-		takIdData, err := json.Marshal(model.AuthToken{Token: token})
-		if err != nil {
-			errorInternalResponse(w,err)
-			return
-		}
-		w.Header().Set(contentTypeHeader, jsonMimeType)
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(takIdData)
+	login := model.AdminLogin
+	if len(signin.Login) > 0 {
+		login, _ = model.NormalizeLogin(signin.Login)
+	}
+	// the unknown logins are locked out too, so they look the same as the known ones
+	loginKey, ipKey := strings.ToLower(strings.TrimSpace(signin.Login)), clientIP(r)
+	if len(loginKey) == 0 {
+		loginKey = model.AdminLogin
+	}
+	now := time.Now()
+	if wait := max(s.loginFailures.locked(loginKey, now), s.ipFailures.locked(ipKey, now)); wait > 0 {
+		tooManyRequestsResponse(w, wait)
+		return
+	}
 
-		if err != nil {
-			errorInternalResponse(nil,err)
-			return
-		}
+	user, err := s.store.GetUserByLogin(login)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorInternalResponse(w, err)
+		return
+	}
+
+	// the password of an unknown login is checked too, so it takes as long as a known one
+	if user.CheckPassword(signin.Password) && err == nil {
+		// the address is not forgiven, one account of its own would unlock it
+		s.loginFailures.reset(loginKey)
+		s.writeTokens(w, user)
 	} else {
+		s.loginFailures.fail(loginKey, now)
+		s.ipFailures.fail(ipKey, now)
 		errData, err := json.Marshal(model.ErrorResponse{Error: "wrong password"})
 		if err != nil {
 			errorInternalResponse(w,err)
@@ -0,0 +1,809 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/model"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func request(t *testing.T, h http.Handler, method string, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		assert.NoError(t, err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, bytes.NewReader(data)))
+
+	var m map[string]any
+	if w.Header().Get(contentTypeHeader) == jsonMimeType {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &m))
+	}
+	return w, m
+}
+
+func TestTaskHandlers(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	h := New(model.NewMemoryStore()).Router(t.TempDir())
+	today := time.Now().Format(model.DateFormat)
+
+	w, m := request(t, h, http.MethodPost, "/api/task", map[string]any{"title": "Полить цветы", "repeat": "d 2"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, float64(1), m["id"])
+
+	_, m = request(t, h, http.MethodPost, "/api/task", map[string]any{"title": ""})
+	assert.NotEmpty(t, m["error"])
+
+	_, m = request(t, h, http.MethodGet, "/api/task?id=1", nil)
+	assert.Equal(t, "Полить цветы", m["title"])
+	assert.Equal(t, today, m["date"])
+
+	_, m = request(t, h, http.MethodGet, "/api/tasks?search=цветы", nil)
+	assert.Len(t, m["tasks"], 1)
+
+	w, m = request(t, h, http.MethodPost, "/api/task/done?id=1", nil)
+	assert.Empty(t, m)
+	op := w.Header().Get(undoHeader)
+	assert.NotEmpty(t, op)
+
+	_, m = request(t, h, http.MethodGet, "/api/task?id=1", nil)
+	assert.Equal(t, time.Now().AddDate(0, 0, 2).Format(model.DateFormat), m["date"])
+
+	_, m = request(t, h, http.MethodGet, "/api/task/history?id=1", nil)
+	assert.Len(t, m["completions"], 1)
+
+	_, m = request(t, h, http.MethodPost, "/api/undo?op="+op, nil)
+	assert.Empty(t, m)
+	_, m = request(t, h, http.MethodGet, "/api/task?id=1", nil)
+	assert.Equal(t, today, m["date"])
+
+	w, m = request(t, h, http.MethodDelete, "/api/task?id=1", nil)
+	assert.Empty(t, m)
+	_, m = request(t, h, http.MethodGet, "/api/task?id=1", nil)
+	assert.NotEmpty(t, m["error"])
+
+	_, m = request(t, h, http.MethodPost, "/api/undo?op="+w.Header().Get(undoHeader), nil)
+	assert.Empty(t, m)
+	_, m = request(t, h, http.MethodGet, "/api/tasks", nil)
+	assert.Len(t, m["tasks"], 1)
+}
+
+func TestTasksPaging(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	h := New(model.NewMemoryStore()).Router(t.TempDir())
+	now := time.Now()
+	for i, title := range []string{"В", "А", "Б"} {
+		request(t, h, http.MethodPost, "/api/task", map[string]any{
+			"title":   title,
+			"comment": "страница",
+			"date":    now.AddDate(0, 0, 3-i).Format(model.DateFormat),
+		})
+	}
+
+	// without a search index rank is the date order, it pages the same way
+	for _, list := range []string{"/api/tasks?limit=2", "/api/tasks?search=страница&sort=rank&limit=2"} {
+		var titles []any
+		target := list
+		for target != "" {
+			_, m := request(t, h, http.MethodGet, target, nil)
+			assert.Equal(t, float64(3), m["total"])
+			for _, v := range m["tasks"].([]any) {
+				titles = append(titles, v.(map[string]any)["title"])
+			}
+			target = ""
+			if next, ok := m["next"]; ok {
+				target = list + "&after=" + next.(string)
+			}
+		}
+		assert.Equal(t, []any{"Б", "А", "В"}, titles, list)
+	}
+
+	_, m := request(t, h, http.MethodGet, "/api/tasks?sort=-title&offset=1", nil)
+	assert.Len(t, m["tasks"], 2)
+	assert.Equal(t, "Б", m["tasks"].([]any)[0].(map[string]any)["title"])
+}
+
+func TestAgendaTruncated(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	store := model.NewMemoryStore()
+	h := New(store).Router(t.TempDir())
+	from := time.Now().AddDate(0, 0, 1).Format(model.DateFormat)
+	to := time.Now().AddDate(0, 0, 7).Format(model.DateFormat)
+	target := "/api/tasks?from=" + from + "&to=" + to
+
+	for i := 0; i < model.MaxRangeTasks; i++ {
+		_, err := store.InsertTask(model.Task{Title: "Задача", Date: from})
+		assert.NoError(t, err)
+	}
+	_, m := request(t, h, http.MethodGet, target, nil)
+	assert.Equal(t, float64(model.MaxRangeTasks), m["total"])
+	assert.Nil(t, m["truncated"])
+
+	// the tasks dated later are the ones left out
+	_, err := store.InsertTask(model.Task{Title: "Последняя", Date: to})
+	assert.NoError(t, err)
+	_, m = request(t, h, http.MethodGet, target+"&sort=-date", nil)
+	assert.Equal(t, float64(model.MaxRangeTasks), m["total"])
+	assert.Equal(t, true, m["truncated"])
+	assert.Equal(t, "Задача", m["tasks"].([]any)[0].(map[string]any)["title"])
+}
+
+func TestAgendaOldTasks(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	store := model.NewMemoryStore()
+	h := New(store).Router(t.TempDir())
+
+	// a daily task dated decades ago is moved to the range in one step
+	_, err := store.InsertTask(model.Task{Title: "Зарядка", Date: "19500101", Repeat: "d 1"})
+	assert.NoError(t, err)
+	_, m := request(t, h, http.MethodGet, "/api/tasks?from=20240101&to=20240107", nil)
+	assert.Equal(t, float64(7), m["total"])
+	assert.Nil(t, m["truncated"])
+
+	// the occurrences of a repeat_count have to be counted one by one until the limit
+	_, err = store.InsertTask(model.Task{Title: "Таблетка", Date: "19500101", Repeat: "d 1", RepeatCount: 100000})
+	assert.NoError(t, err)
+	_, m = request(t, h, http.MethodGet, "/api/tasks?from=20240101&to=20240107", nil)
+	assert.Equal(t, float64(7), m["total"])
+	assert.Equal(t, true, m["truncated"])
+}
+
+func TestTasksQuery(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	h := New(model.NewMemoryStore()).Router(t.TempDir())
+	for _, task := range []map[string]any{
+		{"title": "Отчёт за месяц", "comment": "draft"},
+		{"title": "Отчёт годовой", "repeat": "d 7"},
+		{"title": "Купить воду", "repeat": "w 1"},
+	} {
+		request(t, h, http.MethodPost, "/api/task", task)
+	}
+
+	_, m := request(t, h, http.MethodGet, "/api/tasks?q=title:отчёт+-comment:DRAFT", nil)
+	assert.Len(t, m["tasks"], 1)
+	assert.Equal(t, "Отчёт годовой", m["tasks"].([]any)[0].(map[string]any)["title"])
+	assert.Equal(t, "title:отчёт -comment:DRAFT", m["query"])
+
+	_, m = request(t, h, http.MethodGet, "/api/tasks?q=repeat:any+-воду", nil)
+	assert.Len(t, m["tasks"], 1)
+
+	// an unknown field is a part of the text
+	_, m = request(t, h, http.MethodGet, "/api/tasks?q=owner:me", nil)
+	assert.Empty(t, m["error"])
+	assert.Len(t, m["tasks"], 0)
+	assert.Equal(t, "owner:me", m["query"])
+	_, m = request(t, h, http.MethodGet, "/api/tasks?q=date:завтра", nil)
+	assert.NotEmpty(t, m["error"])
+}
+
+func TestTagHandlers(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	h := New(model.NewMemoryStore()).Router(t.TempDir())
+
+	w, m := request(t, h, http.MethodPost, "/api/task", map[string]any{"title": "Дежурство", "tags": []string{"OnCall", "team"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w, _ = request(t, h, http.MethodPost, "/api/tags", map[string]any{"name": "personal"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	_, m = request(t, h, http.MethodPost, "/api/tags", map[string]any{"name": "Team"})
+	assert.NotEmpty(t, m["error"])
+
+	_, m = request(t, h, http.MethodGet, "/api/tags", nil)
+	assert.Len(t, m["tags"], 3)
+	_, m = request(t, h, http.MethodGet, "/api/tasks?tag=oncall", nil)
+	assert.Len(t, m["tasks"], 1)
+
+	_, m = request(t, h, http.MethodPut, "/api/tags", map[string]any{"id": "1", "name": "duty"})
+	assert.Empty(t, m["error"])
+	_, m = request(t, h, http.MethodDelete, "/api/tags?id=2", nil)
+	assert.Empty(t, m)
+	_, m = request(t, h, http.MethodGet, "/api/task?id=1", nil)
+	assert.Equal(t, []any{"duty"}, m["tags"])
+}
+
+func TestTasksPriority(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	h := New(model.NewMemoryStore()).Router(t.TempDir())
+	for i, title := range []string{"Низкий", "Высокий", "Средний"} {
+		request(t, h, http.MethodPost, "/api/task", map[string]any{"title": title, "priority": []int{0, 3, 1}[i]})
+	}
+	request(t, h, http.MethodPost, "/api/task", map[string]any{"title": "Ещё низкий"})
+
+	_, m := request(t, h, http.MethodPost, "/api/tasks/reorder", map[string]any{"ids": []string{"4", "1"}})
+	assert.Empty(t, m)
+
+	var titles []any
+	target := "/api/tasks?sort=priority&limit=3"
+	for target != "" {
+		_, m = request(t, h, http.MethodGet, target, nil)
+		for _, v := range m["tasks"].([]any) {
+			titles = append(titles, v.(map[string]any)["title"])
+		}
+		target = ""
+		if next, ok := m["next"]; ok {
+			target = "/api/tasks?sort=priority&limit=3&after=" + next.(string)
+		}
+	}
+	assert.Equal(t, []any{"Высокий", "Средний", "Ещё низкий", "Низкий"}, titles)
+
+	_, m = request(t, h, http.MethodPost, "/api/task", map[string]any{"title": "Срочно", "priority": 5})
+	assert.NotEmpty(t, m["error"])
+}
+
+func TestUserHandlers(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	t.Setenv("TODO_SIGNUP", "")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	h := New(store).Router(t.TempDir())
+
+	signin := func(login, password string) string {
+		_, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"login": login, "password": password})
+		token, _ := m["token"].(string)
+		return token
+	}
+	as := func(token, method, target string, body any) (int, map[string]any) {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, target, bytes.NewReader(data))
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var m map[string]any
+		json.Unmarshal(w.Body.Bytes(), &m)
+		return w.Code, m
+	}
+
+	assert.Empty(t, signin("", "wrong"))
+	admin := signin("", "secret")
+	assert.NotEmpty(t, admin)
+	code, _ := as("", http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = as(admin, http.MethodPost, "/api/users", map[string]any{"login": "Alice", "password": "alice password"})
+	assert.Equal(t, http.StatusCreated, code)
+	w, _ := request(t, h, http.MethodPost, "/api/signup", map[string]any{"login": "bob", "password": "bob password"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	t.Setenv("TODO_SIGNUP", "true")
+	w, _ = request(t, h, http.MethodPost, "/api/signup", map[string]any{"login": "bob", "password": "bob password"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	alice, bob := signin("alice", "alice password"), signin("bob", "bob password")
+	assert.NotEmpty(t, alice)
+	assert.NotEmpty(t, bob)
+
+	// every account sees only its own tasks and tags
+	as(alice, http.MethodPost, "/api/task", map[string]any{"title": "Задача Алисы", "tags": []string{"work"}})
+	as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Задача Боба", "tags": []string{"work"}})
+	_, m := as(alice, http.MethodGet, "/api/tasks", nil)
+	assert.Len(t, m["tasks"], 1)
+	_, m = as(admin, http.MethodGet, "/api/tasks", nil)
+	assert.Len(t, m["tasks"], 0)
+	_, m = as(bob, http.MethodGet, "/api/task?id=1", nil)
+	assert.NotEmpty(t, m["error"])
+	_, m = as(bob, http.MethodDelete, "/api/task?id=1", nil)
+	assert.NotEmpty(t, m["error"])
+	_, m = as(bob, http.MethodGet, "/api/tags", nil)
+	assert.Len(t, m["tags"], 1)
+
+	code, _ = as(bob, http.MethodGet, "/api/users", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = as(bob, http.MethodPut, "/api/users", map[string]any{"id": "2", "password": "taken over"})
+	assert.Equal(t, http.StatusForbidden, code)
+	// the own password only changes with the old one
+	code, m = as(bob, http.MethodPut, "/api/users", map[string]any{"id": "3", "password": "new bob password"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.NotEmpty(t, m["error"])
+	code, _ = as(bob, http.MethodPut, "/api/users", map[string]any{"id": "3", "password": "new bob password", "old_password": "wrong password"})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.NotEmpty(t, signin("bob", "bob password"))
+	code, m = as(bob, http.MethodPut, "/api/users", map[string]any{"id": "3", "password": "new bob password",
+		"old_password": "bob password", "role": "admin"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, m["old_password"])
+	assert.Equal(t, model.RoleEditor, m["role"])
+	assert.Empty(t, signin("bob", "bob password"))
+	assert.NotEmpty(t, signin("bob", "new bob password"))
+	// a new password revokes the tokens of the account
+	code, _ = as(bob, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	// an admin changes the password of another account without its old password
+	code, _ = as(admin, http.MethodPut, "/api/users", map[string]any{"id": "2", "password": "new alice password"})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(alice, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	alice = signin("alice", "new alice password")
+	assert.NotEmpty(t, alice)
+	code, _ = as(alice, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	// the web sign-in finds the admin account by its login
+	code, m = as(admin, http.MethodPut, "/api/users", map[string]any{"id": "1", "login": "root"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.NotEmpty(t, m["error"])
+	assert.NotEmpty(t, signin("", "secret"))
+
+	code, _ = as(admin, http.MethodDelete, "/api/users?id=2", nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(alice, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRoles(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	h := New(store).Router(t.TempDir())
+
+	signin := func(login, password string) string {
+		_, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"login": login, "password": password})
+		token, _ := m["token"].(string)
+		return token
+	}
+	as := func(token, method, target string, body any) (int, map[string]any) {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, target, bytes.NewReader(data))
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var m map[string]any
+		json.Unmarshal(w.Body.Bytes(), &m)
+		return w.Code, m
+	}
+
+	admin := signin("", "secret")
+	code, m := as(admin, http.MethodPost, "/api/users", map[string]any{"login": "intern", "password": "intern password", "role": "viewer"})
+	assert.Equal(t, http.StatusCreated, code)
+	internID := m["id"].(float64)
+	code, _ = as(admin, http.MethodPost, "/api/users", map[string]any{"login": "editor", "password": "editor password"})
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = as(admin, http.MethodPost, "/api/users", map[string]any{"login": "boss", "password": "boss password", "role": "owner"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	intern, editor := signin("intern", "intern password"), signin("editor", "editor password")
+
+	code, _ = as(intern, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(intern, http.MethodGet, "/api/task?id=1", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, m = as(intern, http.MethodPost, "/api/task", map[string]any{"title": "Задача стажёра"})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.NotEmpty(t, m["error"])
+
+	code, m = as(editor, http.MethodPost, "/api/task", map[string]any{"title": "Задача редактора"})
+	assert.Equal(t, http.StatusCreated, code)
+	id := fmt.Sprint(m["id"])
+	code, _ = as(editor, http.MethodPut, "/api/task", map[string]any{"id": id, "title": "Задача редактора", "date": time.Now().Format(model.DateFormat)})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(editor, http.MethodPost, "/api/task/done?id="+id, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(editor, http.MethodDelete, "/api/task?id="+id, nil)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = as(editor, http.MethodGet, "/api/users", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = as(admin, http.MethodPost, "/api/task", map[string]any{"title": "Задача админа"})
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = as(admin, http.MethodDelete, "/api/task?id=2", nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	// only an admin changes the roles, the admin account stays an admin
+	code, m = as(intern, http.MethodPut, "/api/users", map[string]any{"id": fmt.Sprint(internID), "role": "editor"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, model.RoleViewer, m["role"])
+	code, m = as(admin, http.MethodPut, "/api/users", map[string]any{"id": fmt.Sprint(internID), "role": "editor"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, model.RoleEditor, m["role"])
+	code, _ = as(intern, http.MethodPost, "/api/task", map[string]any{"title": "Задача стажёра"})
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = as(admin, http.MethodPut, "/api/users", map[string]any{"id": "1", "role": "viewer"})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestLists(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	h := New(store).Router(t.TempDir())
+
+	signin := func(login, password string) string {
+		_, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"login": login, "password": password})
+		token, _ := m["token"].(string)
+		return token
+	}
+	as := func(token, method, target string, body any) (int, map[string]any) {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, target, bytes.NewReader(data))
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var m map[string]any
+		json.Unmarshal(w.Body.Bytes(), &m)
+		return w.Code, m
+	}
+	tasks := func(token, query string) []any {
+		code, m := as(token, http.MethodGet, "/api/tasks"+query, nil)
+		assert.Equal(t, http.StatusOK, code)
+		return m["tasks"].([]any)
+	}
+
+	admin := signin("", "secret")
+	ids := make(map[string]string)
+	for _, login := range []string{"alice", "bob", "carol"} {
+		code, m := as(admin, http.MethodPost, "/api/users", map[string]any{"login": login, "password": login + " password"})
+		assert.Equal(t, http.StatusCreated, code)
+		ids[login] = fmt.Sprint(m["id"])
+	}
+	alice, bob, carol := signin("alice", "alice password"), signin("bob", "bob password"), signin("carol", "carol password")
+	bobID := mustAtoi(ids["bob"])
+
+	code, m := as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "On-call", "everyone": "write"})
+	assert.Equal(t, http.StatusCreated, code)
+	onCall := fmt.Sprint(m["id"])
+	code, m = as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "Alice"})
+	assert.Equal(t, http.StatusCreated, code)
+	private := fmt.Sprint(m["id"])
+	code, m = as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "Release", "members": []any{map[string]any{"user_id": bobID}}})
+	assert.Equal(t, http.StatusCreated, code)
+	release := fmt.Sprint(m["id"])
+	code, _ = as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "Ghosts", "members": []any{map[string]any{"user_id": 999}}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "Open", "everyone": "manage"})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, m = as(bob, http.MethodGet, "/api/lists", nil)
+	assert.Equal(t, http.StatusOK, code)
+	lists := m["lists"].([]any)
+	if assert.Len(t, lists, 2) {
+		assert.Equal(t, "On-call", lists[0].(map[string]any)["name"])
+		assert.Equal(t, model.PermissionWrite, lists[0].(map[string]any)["permission"])
+		assert.Equal(t, model.PermissionRead, lists[1].(map[string]any)["permission"])
+		assert.Equal(t, "bob", lists[1].(map[string]any)["members"].([]any)[0].(map[string]any)["login"])
+	}
+	_, m = as(carol, http.MethodGet, "/api/lists", nil)
+	assert.Len(t, m["lists"], 1)
+
+	// everyone writes to the on-call list, the read-only member only sees the release list
+	code, m = as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Дежурство", "list_id": onCall})
+	assert.Equal(t, http.StatusBadRequest, code, "list_id is a number")
+	code, m = as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Дежурство", "list_id": mustAtoi(onCall)})
+	assert.Equal(t, http.StatusCreated, code)
+	duty := fmt.Sprint(m["id"])
+	code, _ = as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Чужой список", "list_id": mustAtoi(private)})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Релиз", "list_id": mustAtoi(release)})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, m = as(alice, http.MethodPost, "/api/task", map[string]any{"title": "Релиз", "list_id": mustAtoi(release)})
+	assert.Equal(t, http.StatusCreated, code)
+	releaseTask := fmt.Sprint(m["id"])
+	code, _ = as(bob, http.MethodPost, "/api/task", map[string]any{"title": "Личная задача"})
+	assert.Equal(t, http.StatusCreated, code)
+
+	assert.Len(t, tasks(carol, "?list_id="+onCall), 1)
+	assert.Len(t, tasks(carol, ""), 1)
+	assert.Len(t, tasks(bob, ""), 3)
+	assert.Len(t, tasks(bob, "?list_id=0"), 1)
+	assert.Len(t, tasks(bob, "?list_id="+release), 1)
+	code, _ = as(bob, http.MethodGet, "/api/tasks?list_id=x", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, m = as(bob, http.MethodGet, "/api/task?id="+releaseTask, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(mustAtoi(release)), m["list_id"])
+	code, _ = as(bob, http.MethodPut, "/api/task", map[string]any{"id": releaseTask, "title": "Релиз", "date": time.Now().Format(model.DateFormat)})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = as(bob, http.MethodPost, "/api/task/done?id="+releaseTask, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// moving a task to list 0 makes it private, only its creator or a manager of the list does it
+	code, _ = as(bob, http.MethodPost, "/api/task/move?id="+duty+"&list_id="+release, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = as(carol, http.MethodPost, "/api/task/move?id="+duty+"&list_id=0", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Len(t, tasks(carol, "?list_id=0"), 0)
+	code, _ = as(bob, http.MethodPost, "/api/task/move?id="+duty+"&list_id=0", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, tasks(carol, "?list_id="+onCall), 0)
+	assert.Len(t, tasks(bob, "?list_id=0"), 2)
+	code, _ = as(bob, http.MethodPost, "/api/task/move?id="+duty+"&list_id="+onCall, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(alice, http.MethodPost, "/api/task/move?id="+duty+"&list_id=0", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, tasks(alice, "?list_id=0"), 1)
+	code, _ = as(alice, http.MethodPost, "/api/task/move?id="+duty+"&list_id="+onCall, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = as(bob, http.MethodPost, "/api/task/move?id="+releaseTask+"&list_id=0", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// only the managers change a list
+	code, _ = as(bob, http.MethodPut, "/api/lists", map[string]any{"id": release, "name": "Релиз 2"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, m = as(alice, http.MethodPut, "/api/lists", map[string]any{"id": release, "name": "Release",
+		"members": []any{map[string]any{"user_id": bobID, "permission": "manage"}}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, model.PermissionManage, m["members"].([]any)[0].(map[string]any)["permission"])
+	code, m = as(bob, http.MethodPut, "/api/lists", map[string]any{"id": release, "name": "Релиз 2"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, m["members"], 1, "the members are kept")
+	code, _ = as(bob, http.MethodPut, "/api/task", map[string]any{"id": releaseTask, "title": "Релиз", "date": time.Now().Format(model.DateFormat)})
+	assert.Equal(t, http.StatusOK, code)
+	code, m = as(bob, http.MethodGet, "/api/task?id="+releaseTask, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(mustAtoi(release)), m["list_id"], "an update keeps the list")
+
+	code, m = as(alice, http.MethodDelete, "/api/lists?id="+onCall, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, m["error"], "has tasks")
+	code, _ = as(carol, http.MethodDelete, "/api/lists?id="+private, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = as(alice, http.MethodDelete, "/api/lists?id="+private, nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	// the archived tasks of a list do not keep it from being deleted
+	code, m = as(alice, http.MethodPost, "/api/lists", map[string]any{"name": "Готово"})
+	assert.Equal(t, http.StatusCreated, code)
+	finished := fmt.Sprint(m["id"])
+	code, m = as(alice, http.MethodPost, "/api/task", map[string]any{"title": "Сдать отчёт", "list_id": mustAtoi(finished)})
+	assert.Equal(t, http.StatusCreated, code)
+	finishedTask := fmt.Sprint(m["id"])
+	code, _ = as(alice, http.MethodPost, "/api/task/done?id="+finishedTask, nil)
+	assert.Equal(t, http.StatusOK, code)
+	_, m = as(alice, http.MethodGet, "/api/task/history?id="+finishedTask, nil)
+	assert.Len(t, m["completions"], 1)
+	code, _ = as(alice, http.MethodDelete, "/api/lists?id="+finished, nil)
+	assert.Equal(t, http.StatusOK, code)
+	_, m = as(alice, http.MethodGet, "/api/task/history?id="+finishedTask, nil)
+	assert.Empty(t, m["completions"])
+
+	// the tasks of a deleted account stay in the lists, its lists go to the admin
+	code, _ = as(admin, http.MethodDelete, "/api/users?id="+ids["alice"], nil)
+	assert.Equal(t, http.StatusOK, code)
+	_, m = as(admin, http.MethodGet, "/api/lists", nil)
+	assert.Len(t, m["lists"], 2)
+	assert.Len(t, tasks(bob, "?list_id="+release), 1)
+}
+
+func mustAtoi(s string) int {
+	var n int
+	fmt.Sscan(s, &n)
+	return n
+}
+
+func TestTokens(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	t.Setenv("TODO_JWT_SECRET", "jwt secret")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	s := New(store)
+	h := s.Router(t.TempDir())
+
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	_, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "secret"})
+	token, refresh := m["token"].(string), m["refresh_token"].(string)
+	assert.Equal(t, http.StatusOK, status(token))
+	// the refresh token is not a token and the password is not the secret
+	assert.Equal(t, http.StatusUnauthorized, status(refresh))
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "1"}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status(forged))
+	expired, err := s.signToken(model.User{ID: "1"}, accessToken, -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status(expired))
+
+	// a refresh token is used once
+	w, m := request(t, h, http.MethodPost, "/api/refresh", map[string]any{"refresh_token": refresh})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, status(m["token"].(string)))
+	w, _ = request(t, h, http.MethodPost, "/api/refresh", map[string]any{"refresh_token": refresh})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	refresh = m["refresh_token"].(string)
+	req := httptest.NewRequest(http.MethodPost, "/api/signout", strings.NewReader(`{"refresh_token":"`+refresh+`"}`))
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, status(token))
+	w, _ = request(t, h, http.MethodPost, "/api/refresh", map[string]any{"refresh_token": refresh})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// a new password revokes both tokens
+	_, m = request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "secret"})
+	token, refresh = m["token"].(string), m["refresh_token"].(string)
+	assert.Equal(t, http.StatusOK, status(token))
+	assert.NoError(t, model.SetAdminPassword(store, "new secret"))
+	assert.Equal(t, http.StatusUnauthorized, status(token))
+	w, _ = request(t, h, http.MethodPost, "/api/refresh", map[string]any{"refresh_token": refresh})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	h := New(store).Router(t.TempDir())
+	_, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "secret"})
+	token := m["token"].(string)
+
+	call := func(cookie, bearer, method, target string, body any) (int, map[string]any) {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, target, bytes.NewReader(data))
+		if len(cookie) > 0 {
+			req.AddCookie(&http.Cookie{Name: "token", Value: cookie})
+		}
+		if len(bearer) > 0 {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var m map[string]any
+		json.Unmarshal(w.Body.Bytes(), &m)
+		return w.Code, m
+	}
+
+	code, m := call(token, "", http.MethodPost, "/api/keys", map[string]any{"name": "cron", "scope": "admin"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, m = call(token, "", http.MethodPost, "/api/keys", map[string]any{"name": "cron"})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, model.ScopeRead, m["scope"])
+	readKey := m["key"].(string)
+	_, m = call(token, "", http.MethodPost, "/api/keys", map[string]any{"name": "bot", "scope": "read-write"})
+	writeKey, writeID := m["key"].(string), m["id"].(string)
+
+	code, _ = call("", readKey, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = call("", readKey, http.MethodPost, "/api/task", map[string]any{"title": "Из cron"})
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = call("", writeKey, http.MethodPost, "/api/task", map[string]any{"title": "Из бота"})
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = call("", writeKey, http.MethodPost, "/api/keys", map[string]any{"name": "more"})
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = call("", "todo_0000", http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	_, m = call(token, "", http.MethodGet, "/api/keys", nil)
+	keys := m["keys"].([]any)
+	assert.Len(t, keys, 2)
+	for _, v := range keys {
+		key := v.(map[string]any)
+		assert.Empty(t, key["key"])
+		assert.NotEmpty(t, key["last_used_at"])
+	}
+
+	code, _ = call(token, "", http.MethodDelete, "/api/keys?id="+writeID, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = call("", writeKey, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(60)
+	for i := 0; i < 60; i++ {
+		assert.Zero(t, l.allow("192.0.2.1", now))
+	}
+	assert.Equal(t, time.Second, l.allow("192.0.2.1", now))
+	assert.Zero(t, l.allow("192.0.2.2", now))
+	assert.Zero(t, l.allow("192.0.2.1", now.Add(time.Second)))
+	assert.Zero(t, newRateLimiter(0).allow("192.0.2.1", now))
+
+	g := newFailureGuard(2)
+	g.fail("admin", now)
+	assert.Zero(t, g.locked("admin", now))
+	g.fail("admin", now)
+	assert.Equal(t, time.Second, g.locked("admin", now))
+	g.fail("admin", now)
+	assert.Equal(t, 2*time.Second, g.locked("admin", now))
+	assert.Zero(t, g.locked("admin", now.Add(2*time.Second)))
+	for i := 0; i < 100; i++ {
+		g.fail("admin", now)
+	}
+	assert.Equal(t, maxLockout, g.locked("admin", now))
+	g.reset("admin")
+	assert.Zero(t, g.locked("admin", now))
+	g.fail("admin", now.Add(-2*failureMemory))
+	g.fail("admin", now)
+	assert.Zero(t, g.locked("admin", now))
+}
+
+func TestRateLimits(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "secret")
+	store := model.NewMemoryStore()
+	assert.NoError(t, model.SetAdminPassword(store, "secret"))
+	h := New(store).Router(t.TempDir())
+
+	signin := func(password string) *httptest.ResponseRecorder {
+		w, _ := request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": password})
+		return w
+	}
+	for i := 0; i < loginFreeAttempts-1; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signin("wrong").Code)
+	}
+	assert.Equal(t, http.StatusOK, signin("secret").Code)
+	// a successful sign-in forgets the failures of the account
+	for i := 0; i < loginFreeAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signin("wrong").Code)
+	}
+	w := signin("secret")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get(retryAfterHeader))
+
+	limits := func(ip, account int) {
+		old, oldAccount := IPRateLimit, AccountRateLimit
+		IPRateLimit, AccountRateLimit = ip, account
+		t.Cleanup(func() { IPRateLimit, AccountRateLimit = old, oldAccount })
+	}
+	limits(3, 0)
+	h = New(store).Router(t.TempDir())
+	for i := 0; i < 3; i++ {
+		w, _ = request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "secret"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w, m := request(t, h, http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get(retryAfterHeader))
+	assert.NotEmpty(t, m["error"])
+
+	limits(0, 2)
+	s := New(store)
+	h = s.Router(t.TempDir())
+	admin, err := store.GetUser(model.AdminID)
+	assert.NoError(t, err)
+	token, err := s.signToken(admin, accessToken, time.Minute)
+	assert.NoError(t, err)
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusTooManyRequests, get())
+}
+
+func TestPasswordHash(t *testing.T) {
+	t.Setenv("TODO_PASSWORD", "")
+	argon, err := model.HashPasswordArgon2id("correct horse")
+	assert.NoError(t, err)
+	bcrypt, err := model.HashPassword("correct horse")
+	assert.NoError(t, err)
+
+	for _, hash := range []string{argon, bcrypt} {
+		t.Setenv("TODO_PASSWORD_HASH", hash)
+		store := model.NewMemoryStore()
+		assert.NoError(t, model.SetAdminPasswordHash(store, hash))
+		h := New(store).Router(t.TempDir())
+
+		w, _ := request(t, h, http.MethodGet, "/api/tasks", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w, _ = request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "wrong horse"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w, m := request(t, h, http.MethodPost, "/api/signin", map[string]any{"password": "correct horse"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, m["token"])
+	}
+
+	store := model.NewMemoryStore()
+	for _, hash := range []string{"correct horse", "$2a$10$short", "$argon2id$v=19$m=0,t=3,p=4$c2FsdA$a2V5", argon[:len(argon)-44]} {
+		assert.Error(t, model.SetAdminPasswordHash(store, hash), hash)
+	}
+}
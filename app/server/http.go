@@ -1,37 +1,139 @@
 package server
 
 import (
+	"crypto/rand"
 	"fmt"
 	"net/http"
+	"os"
 
+	"github.com/ag89201/go_final_project/app/model"
 	"github.com/go-chi/chi/v5"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	mountEndpoint      = "/"
-	jsonMimeType       = "application/json; charset=UTF-8"
-	nextDatePattern    = "/api/nextdate"
-	apiTaskPattern     = "/api/task"
-	apiTasksPattern    = "/api/tasks"
-	apiTaskPatternDone = "/api/task/done"
-	apiSigninPattern   = "/api/signin"
-	contentTypeHeader  = "Content-Type"
+	mountEndpoint       = "/"
+	jsonMimeType        = "application/json; charset=UTF-8"
+	nextDatePattern     = "/api/nextdate"
+	apiTaskPattern      = "/api/task"
+	apiTasksPattern     = "/api/tasks"
+	apiTaskPatternDone  = "/api/task/done"
+	apiTasksReorder     = "/api/tasks/reorder"
+	apiTaskHistory      = "/api/task/history"
+	apiUndoPattern      = "/api/undo"
+	apiTagsPattern      = "/api/tags"
+	apiListsPattern     = "/api/lists"
+	apiTaskMove         = "/api/task/move"
+	apiSigninPattern    = "/api/signin"
+	apiSignupPattern    = "/api/signup"
+	apiSignoutPattern   = "/api/signout"
+	apiRefreshPattern   = "/api/refresh"
+	apiKeysPattern      = "/api/keys"
+	apiUsersPattern     = "/api/users"
+	apiOIDCPattern      = "/api/oidc"
+	apiOIDCLogin        = "/api/oidc/login"
+	apiOIDCCallback     = "/api/oidc/callback"
+	contentTypeHeader   = "Content-Type"
+	acceptHeader        = "Accept"
+	authorizationHeader = "Authorization"
+	undoHeader          = "X-Undo-Operation"
+	retryAfterHeader    = "Retry-After"
+	jsonMediaType       = "application/json"
 )
 
-func Start(port string, webDir string) error {
+// Server serves the web app and the task API from a TaskStore,
+// every account works with its own tasks and the tasks of the lists shared with it.
+type Server struct {
+	store model.TaskStore
+	// secret signs the tokens
+	secret []byte
+	// the limits of the requests and the lockouts after failed sign-ins
+	ipLimiter      *rateLimiter
+	accountLimiter *rateLimiter
+	loginFailures  *failureGuard
+	ipFailures     *failureGuard
+	// oidc signs in with the OpenID Connect provider, nil without one
+	oidc *oidcProvider
+}
+
+// New returns the server of the store. The tokens are signed with TODO_JWT_SECRET,
+// without it they are signed with a random secret and do not outlive the process.
+func New(store model.TaskStore) *Server {
+	secret := []byte(os.Getenv("TODO_JWT_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Panic(err)
+		}
+		if authEnabled() {
+			log.Warn("TODO_JWT_SECRET is not set, the tokens are lost on restart")
+		}
+	}
+	oidc, err := newOIDCProvider()
+	if err != nil {
+		log.Panic(err)
+	}
+	return &Server{
+		store:          store,
+		oidc:           oidc,
+		secret:         secret,
+		ipLimiter:      newRateLimiter(IPRateLimit),
+		accountLimiter: newRateLimiter(AccountRateLimit),
+		loginFailures:  newFailureGuard(loginFreeAttempts),
+		ipFailures:     newFailureGuard(ipFreeAttempts),
+	}
+}
+
+func (s *Server) Router(webDir string) http.Handler {
 
 	r := chi.NewRouter()
+	r.Use(s.LimitIP)
 
 	r.Mount(mountEndpoint, http.FileServer(http.Dir(webDir)))
-	r.Get(nextDatePattern, Auth(NextDateHandler))
-	r.Post(apiTaskPattern, Auth(PostTaskHandler))
-	r.Get(apiTasksPattern, Auth(GetTasksHandler))
-	r.Get(apiTaskPattern, Auth(GetTaskHandler))
-	r.Put(apiTaskPattern, Auth(PutTaskHandler))
-	r.Post(apiTaskPatternDone, Auth(PostDoneTaskHandler))
-	r.Delete(apiTaskPattern, Auth(DeleteTaskHandler))
-	r.Post(apiSigninPattern, SigninHandler)
+	// viewers read the tasks, editors change them and admins delete them and manage
+	// the accounts; all of them manage their own password and API keys
+	viewer := RequireRole(model.RoleViewer)
+	editor := RequireRole(model.RoleEditor)
+	admin := RequireRole(model.RoleAdmin)
+	r.Get(nextDatePattern, s.Auth(editor(s.NextDateHandler)))
+	r.Post(apiTaskPattern, s.Auth(editor(s.PostTaskHandler)))
+	r.Get(apiTasksPattern, s.Auth(viewer(s.GetTasksHandler)))
+	r.Get(apiTaskPattern, s.Auth(viewer(s.GetTaskHandler)))
+	r.Put(apiTaskPattern, s.Auth(editor(s.PutTaskHandler)))
+	r.Post(apiTaskPatternDone, s.Auth(editor(s.PostDoneTaskHandler)))
+	r.Post(apiTasksReorder, s.Auth(editor(s.ReorderTasksHandler)))
+	r.Delete(apiTaskPattern, s.Auth(admin(s.DeleteTaskHandler)))
+	r.Get(apiTaskHistory, s.Auth(editor(s.GetTaskHistoryHandler)))
+	r.Post(apiUndoPattern, s.Auth(editor(s.UndoHandler)))
+	r.Get(apiTagsPattern, s.Auth(editor(s.GetTagsHandler)))
+	r.Post(apiTagsPattern, s.Auth(editor(s.PostTagHandler)))
+	r.Put(apiTagsPattern, s.Auth(editor(s.PutTagHandler)))
+	r.Delete(apiTagsPattern, s.Auth(editor(s.DeleteTagHandler)))
+	r.Get(apiListsPattern, s.Auth(viewer(s.GetListsHandler)))
+	r.Post(apiListsPattern, s.Auth(editor(s.PostListHandler)))
+	r.Put(apiListsPattern, s.Auth(editor(s.PutListHandler)))
+	r.Delete(apiListsPattern, s.Auth(editor(s.DeleteListHandler)))
+	r.Post(apiTaskMove, s.Auth(editor(s.MoveTaskHandler)))
+	r.Get(apiUsersPattern, s.Auth(SessionOnly(admin(s.GetUsersHandler))))
+	r.Post(apiUsersPattern, s.Auth(SessionOnly(admin(s.PostUserHandler))))
+	r.Put(apiUsersPattern, s.Auth(SessionOnly(s.PutUserHandler)))
+	r.Delete(apiUsersPattern, s.Auth(SessionOnly(admin(s.DeleteUserHandler))))
+	r.Get(apiKeysPattern, s.Auth(SessionOnly(s.GetAPIKeysHandler)))
+	r.Post(apiKeysPattern, s.Auth(SessionOnly(s.PostAPIKeyHandler)))
+	r.Delete(apiKeysPattern, s.Auth(SessionOnly(s.DeleteAPIKeyHandler)))
+	r.Post(apiSigninPattern, s.SigninHandler)
+	r.Get(apiOIDCLogin, s.OIDCLoginHandler)
+	r.Get(apiOIDCCallback, s.OIDCCallbackHandler)
+	r.Post(apiSignupPattern, s.SignupHandler)
+	r.Post(apiRefreshPattern, s.RefreshHandler)
+	r.Post(apiSignoutPattern, s.Auth(s.SignoutHandler))
+
+	return r
+}
+
+func Start(port string, webDir string, store model.TaskStore) error {
+
+	r := New(store).Router(webDir)
 
 	// Start server
 	log.Info("Starting server...")
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ag89201/go_final_project/app/model"
+)
+
+func (s *Server) GetListsHandler(w http.ResponseWriter, r *http.Request) {
+	lists, err := s.tasks(r).ListLists()
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.ListsResponse{Lists: lists})
+}
+
+func (s *Server) PostListHandler(w http.ResponseWriter, r *http.Request) {
+	var list model.List
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	if err := list.CheckCorrectData(); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+
+	id, err := s.tasks(r).InsertList(list)
+	if err != nil {
+		if errors.Is(err, model.ErrNoUser) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, model.IdResponse{Id: id})
+}
+
+func (s *Server) PutListHandler(w http.ResponseWriter, r *http.Request) {
+	var list model.List
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	id, err := strconv.Atoi(list.ID)
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+	if err := list.CheckCorrectData(); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+
+	store := s.tasks(r)
+	rowsAffected, err := store.UpdateList(list)
+	if err != nil {
+		if errors.Is(err, model.ErrNoUser) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "list was not found", errors.New("no list with id "+list.ID+" you manage"))
+		return
+	}
+	if list, err = store.GetList(id); err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+
+	rowsAffected, err := s.tasks(r).DeleteList(id)
+	if err != nil {
+		if errors.Is(err, model.ErrListNotEmpty) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "list was not found", errors.New("no list with id "+strconv.Itoa(id)+" you manage"))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// MoveTaskHandler moves the task id to the list list_id, 0 makes it a private task
+// of its creator or of a manager of its list.
+func (s *Server) MoveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+	listID, err := strconv.Atoi(r.URL.Query().Get("list_id"))
+	if err != nil {
+		errorResponse(w, "invalid list_id", err)
+		return
+	}
+
+	if err := s.tasks(r).MoveTask(id, listID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "task or list was not found", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
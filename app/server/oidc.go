@@ -0,0 +1,423 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/model"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// oidcCookie keeps the state, the nonce and the PKCE verifier of a sign-in
+	// between the redirect to the provider and the callback.
+	oidcCookie = "oidc"
+	// oidcLoginTTL is how long the user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcKeysRefresh is how often the keys of the provider may be fetched
+	// for a token signed with an unknown key.
+	oidcKeysRefresh = time.Minute
+	oidcScope       = "openid profile email"
+	oidcTimeout     = 10 * time.Second
+)
+
+// oidcProvider signs the users in with an OpenID Connect provider, using the authorization
+// code flow with PKCE. It is configured with TODO_OIDC_ISSUER, TODO_OIDC_CLIENT_ID,
+// TODO_OIDC_CLIENT_SECRET and TODO_OIDC_REDIRECT_URL, the URL of OIDCCallbackHandler.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	client       *http.Client
+
+	mu sync.Mutex
+	// meta is discovered at the first sign-in
+	meta *oidcMetadata
+	// keys are the RSA keys of the ID tokens by their kid
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the claims of the oidc cookie, jti is the state.
+type oidcClaims struct {
+	jwt.StandardClaims
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// newOIDCProvider returns the provider of the configuration, nil when TODO_OIDC_ISSUER is not set.
+func newOIDCProvider() (*oidcProvider, error) {
+	issuer := strings.TrimSuffix(os.Getenv("TODO_OIDC_ISSUER"), "/")
+	if len(issuer) == 0 {
+		return nil, nil
+	}
+	p := &oidcProvider{
+		issuer:       issuer,
+		clientID:     os.Getenv("TODO_OIDC_CLIENT_ID"),
+		clientSecret: os.Getenv("TODO_OIDC_CLIENT_SECRET"),
+		redirectURL:  os.Getenv("TODO_OIDC_REDIRECT_URL"),
+		client:       &http.Client{Timeout: oidcTimeout},
+	}
+	if len(p.clientID) == 0 || len(p.redirectURL) == 0 {
+		return nil, errors.New("TODO_OIDC_CLIENT_ID and TODO_OIDC_REDIRECT_URL are required with TODO_OIDC_ISSUER")
+	}
+	return p, nil
+}
+
+// metadata returns the endpoints of the provider from its discovery document.
+func (p *oidcProvider) metadata(ctx context.Context) (oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return *p.meta, nil
+	}
+	var meta oidcMetadata
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return meta, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.issuer {
+		return meta, fmt.Errorf("the provider is %q, not %q", meta.Issuer, p.issuer)
+	}
+	if len(meta.AuthorizationEndpoint) == 0 || len(meta.TokenEndpoint) == 0 || len(meta.JWKSURI) == 0 {
+		return meta, errors.New("the provider has no authorization, token or jwks endpoint")
+	}
+	p.meta = &meta
+	return meta, nil
+}
+
+// key returns the public key the ID tokens are signed with, the keys are fetched again
+// when the provider has rotated them.
+func (p *oidcProvider) key(ctx context.Context, meta oidcMetadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < oidcKeysRefresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]*rsa.PublicKey)
+	p.keysFetched = time.Now()
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(acceptHeader, jsonMediaType)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// exchange trades the authorization code and the PKCE verifier for the ID token.
+func (p *oidcProvider) exchange(ctx context.Context, meta oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	req.Header.Set(acceptHeader, jsonMediaType)
+	if len(p.clientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("token endpoint: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(tokens.IDToken) == 0 {
+		return "", fmt.Errorf("%w: the provider refused the code: %s %s", errInvalidToken, tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens.IDToken, nil
+}
+
+// verify checks the signature, the issuer, the audience, the expiry and the nonce
+// of the ID token and returns its claims.
+func (p *oidcProvider) verify(ctx context.Context, meta oidcMetadata, idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	if iss, _ := claims["iss"].(string); iss != meta.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", errInvalidToken, iss)
+	}
+	if !claims.VerifyAudience(p.clientID, true) || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("%w: the ID token is expired or not for this client", errInvalidToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.clientID {
+		return nil, fmt.Errorf("%w: the ID token is for %q", errInvalidToken, azp)
+	}
+	if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: wrong nonce", errInvalidToken)
+	}
+	if sub, _ := claims["sub"].(string); len(sub) == 0 {
+		return nil, fmt.Errorf("%w: no subject", errInvalidToken)
+	}
+	return claims, nil
+}
+
+// randomString returns n random bytes in base64url.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// OIDCLoginHandler redirects to the provider to sign in, it comes back to OIDCCallbackHandler.
+func (s *Server) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		errorResponse(w, "single sign-on is not available", errors.New("TODO_OIDC_ISSUER is not set"))
+		return
+	}
+	meta, err := s.oidc.metadata(r.Context())
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+
+	var claims oidcClaims
+	for _, v := range []*string{&claims.Id, &claims.Nonce, &claims.Verifier} {
+		if *v, err = randomString(32); err != nil {
+			errorInternalResponse(w, err)
+			return
+		}
+	}
+	expires := time.Now().Add(oidcLoginTTL)
+	claims.ExpiresAt = expires.Unix()
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	// the provider redirects back with a top level GET, a lax cookie goes with it
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    cookie,
+		Path:     apiOIDCPattern,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.oidc.redirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(claims.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.oidc.clientID},
+		"redirect_uri":          {s.oidc.redirectURL},
+		"scope":                 {oidcScope},
+		"state":                 {claims.Id},
+		"nonce":                 {claims.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	target := meta.AuthorizationEndpoint + "?" + query.Encode()
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		target = meta.AuthorizationEndpoint + "&" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallbackHandler signs in the account linked to the subject of the ID token,
+// creating it at the first sign-in, sets the token cookie and redirects to the app.
+func (s *Server) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		errorResponse(w, "single sign-on is not available", errors.New("TODO_OIDC_ISSUER is not set"))
+		return
+	}
+	unauthorized := func(err error) {
+		writeJSON(w, http.StatusUnauthorized, model.ErrorResponse{Error: err.Error()})
+	}
+
+	var claims oidcClaims
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		unauthorized(errors.New("the sign-in has expired, start it again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: apiOIDCPattern, MaxAge: -1})
+	_, err = jwt.ParseWithClaims(cookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return s.secret, nil
+	})
+	if err != nil || len(claims.Verifier) == 0 || subtle.ConstantTimeCompare([]byte(claims.Id), []byte(r.URL.Query().Get("state"))) != 1 {
+		unauthorized(errors.New("the sign-in has expired, start it again"))
+		return
+	}
+	if e := r.URL.Query().Get("error"); len(e) > 0 {
+		unauthorized(fmt.Errorf("the provider refused the sign-in: %s %s", e, r.URL.Query().Get("error_description")))
+		return
+	}
+
+	meta, err := s.oidc.metadata(r.Context())
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	idToken, err := s.oidc.exchange(r.Context(), meta, r.URL.Query().Get("code"), claims.Verifier)
+	var idClaims jwt.MapClaims
+	if err == nil {
+		idClaims, err = s.oidc.verify(r.Context(), meta, idToken, claims.Nonce)
+	}
+	var user model.User
+	if err == nil {
+		user, err = s.identityUser(meta.Issuer, idClaims)
+	}
+	if errors.Is(err, errInvalidToken) {
+		unauthorized(err)
+		return
+	}
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+
+	token, err := s.signToken(user, accessToken, TokenTTL)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(TokenTTL),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.oidc.redirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, mountEndpoint, http.StatusFound)
+}
+
+// identityUser returns the account linked to the subject of the ID token. At the first
+// sign-in of the subject a new editor account without a password is created, its login is
+// the preferred username or the name of the email if it is free, otherwise one made
+// from the subject.
+func (s *Server) identityUser(issuer string, claims jwt.MapClaims) (model.User, error) {
+	subject, _ := claims["sub"].(string)
+	user, err := s.store.IdentityUser(issuer, subject)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, err
+	}
+
+	user.Role = model.RoleEditor
+	var logins []string
+	if name, ok := claims["preferred_username"].(string); ok {
+		logins = append(logins, name)
+	}
+	if email, ok := claims["email"].(string); ok {
+		name, _, _ := strings.Cut(email, "@")
+		logins = append(logins, name)
+	}
+	sum := sha256.Sum256([]byte(issuer + " " + subject))
+	logins = append(logins, "sso-"+hex.EncodeToString(sum[:6]))
+
+	for _, login := range logins {
+		if user.Login, err = model.NormalizeLogin(login); err != nil {
+			continue
+		}
+		id, err := s.store.InsertIdentityUser(user, issuer, subject)
+		if errors.Is(err, model.ErrUserExists) {
+			continue
+		}
+		if err != nil {
+			return user, err
+		}
+		user.ID = strconv.Itoa(id)
+		return user, nil
+	}
+	return user, fmt.Errorf("no free login for the subject %q", subject)
+}
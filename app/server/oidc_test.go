@@ -0,0 +1,186 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/model"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIdP is an OpenID Connect provider that signs in whoever is in subject.
+type mockIdP struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	subject  string
+	claims   jwt.MapClaims
+	// the authorization request waiting for its code
+	nonce, challenge string
+}
+
+func newMockIdP(t *testing.T, clientID string) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp := &mockIdP{key: key, clientID: clientID}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(key.E)).Bytes()
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(e),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		idp.nonce, idp.challenge = q.Get("nonce"), q.Get("code_challenge")
+		back, _ := url.Parse(q.Get("redirect_uri"))
+		back.RawQuery = url.Values{"code": {"the-code"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, back.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		// the credentials are form encoded, RFC 6749 2.3.1
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if id != clientID || secret != "client secret" || r.PostFormValue("code") != "the-code" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss": idp.URL, "aud": []string{clientID}, "sub": idp.subject, "nonce": idp.nonce,
+			"exp": time.Now().Add(time.Minute).Unix(), "preferred_username": "Ivan",
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func TestOIDC(t *testing.T) {
+	idp := newMockIdP(t, "todo")
+	t.Setenv("TODO_PASSWORD", "")
+	t.Setenv("TODO_OIDC_ISSUER", idp.URL)
+	t.Setenv("TODO_OIDC_CLIENT_ID", "todo")
+	t.Setenv("TODO_OIDC_CLIENT_SECRET", "client secret")
+	t.Setenv("TODO_OIDC_REDIRECT_URL", "http://todo.test/api/oidc/callback")
+	store := model.NewMemoryStore()
+	_, err := store.InsertUser(model.User{Login: "ivan"})
+	assert.NoError(t, err)
+	h := New(store).Router(t.TempDir())
+
+	// signIn goes through the provider and returns the status and the cookies of the callback
+	signIn := func(tamper func(callback *url.URL)) (int, []*http.Cookie) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+		assert.Equal(t, http.StatusFound, w.Code)
+		cookies := w.Result().Cookies()
+
+		resp, err := (&http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}).Get(w.Header().Get("Location"))
+		assert.NoError(t, err)
+		resp.Body.Close()
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		assert.NoError(t, err)
+		if tamper != nil {
+			tamper(callback)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Result().Cookies()
+	}
+	tasks := func(cookies []*http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+		for _, c := range cookies {
+			if c.Name == "token" {
+				req.AddCookie(c)
+			}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, tasks(nil))
+
+	idp.subject = "user-1"
+	code, cookies := signIn(nil)
+	assert.Equal(t, http.StatusFound, code)
+	assert.Equal(t, http.StatusOK, tasks(cookies))
+	user, err := store.IdentityUser(idp.URL, "user-1")
+	assert.NoError(t, err)
+	// "ivan" is taken by another account
+	assert.Equal(t, "sso-", user.Login[:4])
+	assert.Equal(t, model.RoleEditor, user.Role)
+
+	// the same subject signs in to the same account
+	_, cookies = signIn(nil)
+	assert.Equal(t, http.StatusOK, tasks(cookies))
+	users, err := store.ListUsers()
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+
+	idp.subject = "user-2"
+	idp.claims = jwt.MapClaims{"preferred_username": "Petr"}
+	_, cookies = signIn(nil)
+	assert.Equal(t, http.StatusOK, tasks(cookies))
+	user, err = store.IdentityUser(idp.URL, "user-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "petr", user.Login)
+
+	code, _ = signIn(func(callback *url.URL) {
+		q := callback.Query()
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = signIn(func(*url.URL) { idp.challenge = "other" })
+	assert.Equal(t, http.StatusUnauthorized, code)
+	for _, claims := range []jwt.MapClaims{
+		{"aud": "other"},
+		{"nonce": "replayed"},
+		{"iss": "https://evil.test"},
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+	} {
+		idp.claims = claims
+		code, _ = signIn(nil)
+		assert.Equal(t, http.StatusUnauthorized, code, claims)
+	}
+}
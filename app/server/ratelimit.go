@@ -0,0 +1,197 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ag89201/go_final_project/app/model"
+)
+
+const (
+	// DefIPRateLimit is the default number of requests per minute from an address,
+	// it is high as the whole office may come from one address.
+	DefIPRateLimit = 3000
+	// DefAccountRateLimit is the default number of requests per minute of an account.
+	DefAccountRateLimit = 1200
+
+	// loginFreeAttempts and ipFreeAttempts are the failed sign-ins before the lockouts.
+	loginFreeAttempts = 5
+	ipFreeAttempts    = 20
+	// firstLockout doubles with every failed sign-in after the free ones up to maxLockout.
+	firstLockout = time.Second
+	maxLockout   = 15 * time.Minute
+	// failureMemory is how long the failed sign-ins are remembered.
+	failureMemory = time.Hour
+)
+
+var (
+	// IPRateLimit is the number of requests per minute from an address, 0 turns the limit off.
+	IPRateLimit = DefIPRateLimit
+	// AccountRateLimit is the number of requests per minute of an account, 0 turns the limit off.
+	AccountRateLimit = DefAccountRateLimit
+)
+
+// rateLimiter is a token bucket for every key: a key can make perMinute requests at once
+// and then gets perMinute requests a minute.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[string]*bucket
+	swept     time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a request of the key from its bucket. It returns 0 when the request
+// is allowed, otherwise how long to wait before the next one.
+func (l *rateLimiter) allow(key string, now time.Time) time.Duration {
+	if l.perMinute <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a bucket left alone for a minute is full again, it is the same as no bucket
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	size := float64(l.perMinute)
+	perSecond := size / 60
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: size, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+}
+
+// failureGuard locks a key out after its free failed sign-ins, for a time that doubles
+// with every further failure.
+type failureGuard struct {
+	mu       sync.Mutex
+	free     int
+	failures map[string]*failures
+	swept    time.Time
+}
+
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func newFailureGuard(free int) *failureGuard {
+	return &failureGuard{free: free, failures: make(map[string]*failures)}
+}
+
+// locked returns how long the key is still locked out, 0 if it is not.
+func (g *failureGuard) locked(key string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.failures[key]; ok && now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failed sign-in of the key.
+func (g *failureGuard) fail(key string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Sub(g.swept) > time.Minute {
+		for k, f := range g.failures {
+			if now.Sub(f.last) > failureMemory {
+				delete(g.failures, k)
+			}
+		}
+		g.swept = now
+	}
+
+	f, ok := g.failures[key]
+	if !ok || now.Sub(f.last) > failureMemory {
+		f = &failures{}
+		g.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if extra := f.count - g.free; extra >= 0 {
+		lockout := maxLockout
+		if extra < 20 {
+			lockout = min(firstLockout<<extra, maxLockout)
+		}
+		f.lockedUntil = now.Add(lockout)
+	}
+}
+
+// reset forgets the failed sign-ins of the key.
+func (g *failureGuard) reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, key)
+}
+
+// clientIP returns the address the request comes from. The forwarding headers are
+// not trusted, anyone can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// LimitIP rejects the requests from an address over IPRateLimit.
+func (s *Server) LimitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := s.ipLimiter.allow(clientIP(r), time.Now()); wait > 0 {
+			tooManyRequestsResponse(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitAccount rejects the requests of an account over AccountRateLimit,
+// it goes after Auth.
+func (s *Server) LimitAccount(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wait := s.accountLimiter.allow(currentUser(r).ID, time.Now()); wait > 0 {
+			tooManyRequestsResponse(w, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// tooManyRequestsResponse tells the client to retry after wait, rounded up to seconds.
+func tooManyRequestsResponse(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set(retryAfterHeader, strconv.Itoa(max(seconds, 1)))
+	writeJSON(w, http.StatusTooManyRequests, model.ErrorResponse{Error: "too many requests, retry in " + strconv.Itoa(max(seconds, 1)) + "s"})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ag89201/go_final_project/app/model"
+)
+
+func (s *Server) GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.tasks(r).ListTags()
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.TagsResponse{Tags: tags})
+}
+
+func (s *Server) PostTagHandler(w http.ResponseWriter, r *http.Request) {
+	var tag model.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	if err := tag.CheckCorrectData(); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+
+	id, err := s.tasks(r).InsertTag(tag)
+	if err != nil {
+		if errors.Is(err, model.ErrTagExists) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, model.IdResponse{Id: id})
+}
+
+func (s *Server) PutTagHandler(w http.ResponseWriter, r *http.Request) {
+	var tag model.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	if _, err := strconv.Atoi(tag.ID); err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+	if err := tag.CheckCorrectData(); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+
+	rowsAffected, err := s.tasks(r).UpdateTag(tag)
+	if err != nil {
+		if errors.Is(err, model.ErrTagExists) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "tag was not found", errors.New("no tag with id "+tag.ID))
+		return
+	}
+	writeJSON(w, http.StatusOK, tag)
+}
+
+func (s *Server) DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+
+	rowsAffected, err := s.tasks(r).DeleteTag(id)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "tag was not found", errors.New("no tag with id "+strconv.Itoa(id)))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ag89201/go_final_project/app/model"
+)
+
+func (s *Server) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers()
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.UsersResponse{Users: users})
+}
+
+// PostUserHandler creates an account, it is how an admin adds the members of the team.
+func (s *Server) PostUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user model.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	s.insertUser(w, user)
+}
+
+// SignupHandler lets anyone create an editor account when TODO_SIGNUP is on.
+func (s *Server) SignupHandler(w http.ResponseWriter, r *http.Request) {
+	signup, _ := strconv.ParseBool(os.Getenv("TODO_SIGNUP"))
+	if !signup || !authEnabled() {
+		forbiddenResponse(w, errors.New("sign up is disabled"))
+		return
+	}
+
+	var sign model.Sign
+	if err := json.NewDecoder(r.Body).Decode(&sign); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	s.insertUser(w, model.User{Login: sign.Login, Password: sign.Password, Role: model.RoleEditor})
+}
+
+func (s *Server) insertUser(w http.ResponseWriter, user model.User) {
+	if err := user.CheckCorrectData(true); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+
+	id, err := s.store.InsertUser(user)
+	if err != nil {
+		if errors.Is(err, model.ErrUserExists) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, model.IdResponse{Id: id})
+}
+
+// PutUserHandler changes an account. Users change their own login and password,
+// admins change any account and its role. A new own password needs the old one,
+// a new password revokes the tokens of the account. The admin account keeps its login.
+func (s *Server) PutUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user model.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		errorResponse(w, "Error parsing JSON", err)
+		return
+	}
+	id, err := strconv.Atoi(user.ID)
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+	current := currentUser(r)
+	isAdmin := current.HasRole(model.RoleAdmin)
+	if !isAdmin && current.ID != user.ID {
+		forbiddenResponse(w, errors.New("admin rights are required"))
+		return
+	}
+
+	prev, err := s.store.GetUser(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorResponse(w, "user was not found", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	if current.ID == user.ID && len(user.Password) > 0 && len(prev.PasswordHash) > 0 {
+		if len(user.OldPassword) == 0 {
+			errorResponse(w, "invalid data", errors.New("old password is required"))
+			return
+		}
+		if !prev.CheckPassword(user.OldPassword) {
+			forbiddenResponse(w, errors.New("old password is wrong"))
+			return
+		}
+	}
+	user.OldPassword = ""
+	if len(user.Login) == 0 {
+		user.Login = prev.Login
+	}
+	if !isAdmin || len(user.Role) == 0 {
+		user.Role = prev.Role
+	}
+	if id == model.AdminID && user.Role != model.RoleAdmin {
+		errorResponse(w, "invalid data", errors.New("the admin account keeps its admin role"))
+		return
+	}
+	if err := user.CheckCorrectData(false); err != nil {
+		errorResponse(w, "invalid data", err)
+		return
+	}
+	if id == model.AdminID && user.Login != prev.Login {
+		errorResponse(w, "invalid data", errors.New("the admin account keeps its login"))
+		return
+	}
+	if len(user.PasswordHash) == 0 {
+		user.PasswordHash = prev.PasswordHash
+	}
+
+	rowsAffected, err := s.store.UpdateUser(user)
+	if err != nil {
+		if errors.Is(err, model.ErrUserExists) {
+			errorResponse(w, "invalid data", err)
+			return
+		}
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "user was not found", errors.New("no user with id "+user.ID))
+		return
+	}
+	user.CreatedAt = prev.CreatedAt
+	writeJSON(w, http.StatusOK, user)
+}
+
+// DeleteUserHandler deletes an account with its tasks and tags.
+func (s *Server) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		errorResponse(w, "invalid id", err)
+		return
+	}
+	if id == model.AdminID || strconv.Itoa(id) == currentUser(r).ID {
+		errorResponse(w, "invalid id", errors.New("the admin account and your own account can not be deleted"))
+		return
+	}
+
+	rowsAffected, err := s.store.DeleteUser(id)
+	if err != nil {
+		errorInternalResponse(w, err)
+		return
+	}
+	if rowsAffected == 0 {
+		errorResponse(w, "user was not found", errors.New("no user with id "+strconv.Itoa(id)))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
@@ -1,6 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// the runtime image has no zoneinfo, the task time zones are embedded
+	_ "time/tzdata"
+
 	"github.com/ag89201/go_final_project/app/domain"
 	"github.com/ag89201/go_final_project/app/model"
 	"github.com/ag89201/go_final_project/app/server"
@@ -16,32 +27,184 @@ const (
 )
 
 func main() {
-	// get db filename
-	dbFile := domain.GetEnv("TODO_DBFILE", defDbName)
-	log.Info("open database: " + dbFile)
-	if domain.FileNotExists(dbFile) {
-		log.Info("file not exists......")
-		err := domain.CreateFile(dbFile)
+	// hash-password needs no database
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := hashPassword(os.Stdin, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	driver := domain.GetEnv("TODO_DB_DRIVER", model.DriverSQLite)
+	store, err := openStore(driver)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer store.Close()
+
+	if len(os.Args) > 1 {
+		if err := runCommand(store, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Create or upgrade the tables
+	if db, ok := store.(model.Db); ok {
+		log.Info("migrate database......")
+		applied, err := db.MigrateUp()
 		if err != nil {
 			log.Panic(err)
+		}
+		for _, m := range applied {
+			log.Infof("applied migration %04d_%s", m.Version, m.Name)
+		}
+	}
 
+	// TODO_PASSWORD is the password of the admin account, TODO_PASSWORD_HASH is its hash
+	// made by hash-password, so that the password is not kept in the configuration
+	pass, passHash := os.Getenv("TODO_PASSWORD"), os.Getenv("TODO_PASSWORD_HASH")
+	switch {
+	case len(pass) > 0 && len(passHash) > 0:
+		log.Panic("set either TODO_PASSWORD or TODO_PASSWORD_HASH")
+	case len(passHash) > 0:
+		if err := model.SetAdminPasswordHash(store, passHash); err != nil {
+			log.Panic(err)
 		}
-		log.Info("created new file: " + dbFile)
+	case len(pass) > 0:
+		if err := model.SetAdminPassword(store, pass); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	undoWindow, err := time.ParseDuration(domain.GetEnv("TODO_UNDO_WINDOW", model.DefUndoWindow.String()))
+	if err != nil {
+		log.Panic(err)
+	}
+	model.UndoWindow = undoWindow
+
+	if server.TokenTTL, err = time.ParseDuration(domain.GetEnv("TODO_TOKEN_TTL", server.DefTokenTTL.String())); err != nil {
+		log.Panic(err)
 	}
-	//open database
-	var err error
-	if model.Database, err = model.NewDataBase(dbFile); err != nil {
+	if server.RefreshTTL, err = time.ParseDuration(domain.GetEnv("TODO_REFRESH_TTL", server.DefRefreshTTL.String())); err != nil {
 		log.Panic(err)
 	}
-	defer model.Database.Close()
-	// Create the tables
-	log.Info("open|create table......")
-	model.Database.CreateSchedulerTable()
 
-	log.Info("create index......")
-	model.Database.CreateIndex()
+	// the requests per minute from an address and of an account, 0 turns the limit off
+	if server.IPRateLimit, err = strconv.Atoi(domain.GetEnv("TODO_RATE_LIMIT_IP", strconv.Itoa(server.DefIPRateLimit))); err != nil {
+		log.Panic(err)
+	}
+	if server.AccountRateLimit, err = strconv.Atoi(domain.GetEnv("TODO_RATE_LIMIT_ACCOUNT", strconv.Itoa(server.DefAccountRateLimit))); err != nil {
+		log.Panic(err)
+	}
 
 	// Start the web server
 	port := domain.GetEnv("TODO_PORT", defPort)
-	log.Fatal(server.Start(port, webDir))
+	log.Fatal(server.Start(port, webDir, store))
+}
+
+func openStore(driver string) (model.TaskStore, error) {
+	switch driver {
+	case model.DriverMemory:
+		log.Info("using in-memory store, tasks are lost on exit")
+		return model.NewMemoryStore(), nil
+	case model.DriverPostgres:
+		dsn := os.Getenv("TODO_DB_DSN")
+		if len(dsn) == 0 {
+			return nil, errors.New("TODO_DB_DSN is required for postgres")
+		}
+		log.Info("open postgres database")
+		return model.NewDataBase(driver, dsn)
+	case model.DriverSQLite:
+		// get db filename
+		dbFile := domain.GetEnv("TODO_DB_DSN", domain.GetEnv("TODO_DBFILE", defDbName))
+		log.Info("open database: " + dbFile)
+		if domain.FileNotExists(dbFile) {
+			log.Info("file not exists......")
+			err := domain.CreateFile(dbFile)
+			if err != nil {
+				return nil, err
+			}
+			log.Info("created new file: " + dbFile)
+		}
+		return model.NewDataBase(driver, dbFile)
+	default:
+		return nil, fmt.Errorf("unknown TODO_DB_DRIVER: %s", driver)
+	}
+}
+
+const usage = "usage: go_final_project [migrate status|up|down | hash-password [bcrypt|argon2id]]"
+
+// hashPassword reads a password from the first line of in and prints its hash,
+// bcrypt unless argon2id is asked for.
+func hashPassword(in io.Reader, args []string) error {
+	hash := model.HashPassword
+	switch {
+	case len(args) == 0 || len(args) == 1 && args[0] == "bcrypt":
+	case len(args) == 1 && args[0] == "argon2id":
+		hash = model.HashPasswordArgon2id
+	default:
+		return errors.New(usage)
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if err := model.CheckPasswordLength(password); err != nil {
+		return err
+	}
+
+	hashed, err := hash(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hashed)
+	return nil
+}
+
+func runCommand(store model.TaskStore, args []string) error {
+	if args[0] != "migrate" || len(args) != 2 {
+		return errors.New(usage)
+	}
+	db, ok := store.(model.Db)
+	if !ok {
+		return errors.New("the store has no schema to migrate")
+	}
+
+	switch args[1] {
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			appliedAt := "pending"
+			if m.Applied() {
+				appliedAt = m.AppliedAt
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, appliedAt)
+		}
+	case "up":
+		applied, err := db.MigrateUp()
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		m, reverted, err := db.MigrateDown()
+		if err != nil {
+			return err
+		}
+		if reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+	default:
+		return errors.New(usage)
+	}
+	return nil
 }
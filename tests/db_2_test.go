@@ -6,8 +6,8 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
 type Task struct {
@@ -16,6 +16,18 @@ type Task struct {
 	Title   string `db:"title"`
 	Comment string `db:"comment"`
 	Repeat  string `db:"repeat"`
+
+	RepeatUntil string `db:"repeat_until"`
+	RepeatCount int    `db:"repeat_count"`
+	Archived    int    `db:"archived"`
+	Deleted     int    `db:"deleted"`
+	StartTime   string `db:"start_time"`
+	Duration    int    `db:"duration"`
+	TimeZone    string `db:"timezone"`
+	Priority    int    `db:"priority"`
+	Position    int    `db:"position"`
+	OwnerID     int    `db:"owner_id"`
+	ListID      int    `db:"list_id"`
 }
 
 func count(db *sqlx.DB) (int, error) {
@@ -29,7 +41,7 @@ func openDB(t *testing.T) *sqlx.DB {
 	if len(envFile) > 0 {
 		dbfile = envFile
 	}
-	db, err := sqlx.Connect("sqlite3", dbfile)
+	db, err := sqlx.Connect("sqlite", dbfile)
 	assert.NoError(t, err)
 	return db
 }
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getHistory(t *testing.T, id string) []map[string]string {
+	body, err := requestJSON("api/task/history?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+
+	var m map[string][]map[string]string
+	err = json.Unmarshal(body, &m)
+	assert.NoError(t, err)
+	return m["completions"]
+}
+
+func TestHistory(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:  now.Format(`20060102`),
+		title: "Отправить отчёт",
+	})
+	assert.Empty(t, getHistory(t, id))
+
+	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	notFoundTask(t, id)
+
+	var archived Task
+	err = db.Get(&archived, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archived.Archived)
+
+	history := getHistory(t, id)
+	assert.Len(t, history, 1)
+	assert.Equal(t, id, history[0]["task_id"])
+	assert.Equal(t, now.Format(`20060102`), history[0]["date"])
+	_, err = time.Parse(time.RFC3339, history[0]["completed_at"])
+	assert.NoError(t, err)
+
+	ret, err = postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret)
+	assert.Len(t, getHistory(t, id), 1)
+
+	id = addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Полить цветы",
+		repeat: "d 2",
+	})
+	for i := 0; i < 2; i++ {
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+	}
+	history = getHistory(t, id)
+	assert.Len(t, history, 2)
+	assert.Equal(t, now.Format(`20060102`), history[0]["date"])
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), history[1]["date"])
+
+	ret, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	ret, err = postJSON("api/task/history?id=abc", nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
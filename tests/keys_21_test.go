@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	ret, err := postJSON("api/keys", map[string]any{"name": "Скрипт", "scope": "read"}, http.MethodPost)
+	assert.NoError(t, err)
+	key, _ := ret["key"].(string)
+	assert.NotEmpty(t, key)
+	id := fmt.Sprint(ret["id"])
+
+	var hash string
+	assert.NoError(t, db.Get(&hash, `SELECT key_hash FROM api_keys WHERE id = ?`, id))
+	assert.NotEmpty(t, hash)
+	assert.NotEqual(t, key, hash)
+
+	call := func(method, path string) int {
+		req, err := http.NewRequest(method, getURL(path), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "api/tasks"))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodDelete, "api/task?id=1"))
+
+	var lastUsed string
+	assert.NoError(t, db.Get(&lastUsed, `SELECT last_used_at FROM api_keys WHERE id = ?`, id))
+	assert.NotEmpty(t, lastUsed)
+
+	ret, err = postJSON("api/keys?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "api/tasks"))
+}
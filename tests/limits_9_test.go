@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepeatLimits(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	tbl := []map[string]any{
+		{"title": "Без повтора", "repeat_count": 2},
+		{"title": "Без повтора", "repeat_until": now.AddDate(0, 0, 10).Format(`20060102`)},
+		{"title": "Отрицательный", "repeat": "d 1", "repeat_count": -1},
+		{"title": "Плохая дата", "repeat": "d 1", "repeat_until": "2024-01-01"},
+		{"title": "Раньше даты", "repeat": "d 1", "repeat_until": now.AddDate(0, 0, -1).Format(`20060102`)},
+	}
+	for _, v := range tbl {
+		m, err := postJSON("api/task", v, http.MethodPost)
+		assert.NoError(t, err)
+		e, ok := m["error"]
+		assert.False(t, !ok || len(fmt.Sprint(e)) == 0,
+			"Ожидается ошибка для задачи %v", v)
+	}
+
+	check := func(values map[string]any, dates int) {
+		values["date"] = now.Format(`20060102`)
+		m, err := postJSON("api/task", values, http.MethodPost)
+		assert.NoError(t, err)
+		id := fmt.Sprint(m["id"])
+
+		for i := 1; i < dates; i++ {
+			ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+			assert.NoError(t, err)
+			assert.Empty(t, ret)
+
+			var task Task
+			err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+			assert.NoError(t, err)
+			assert.Equal(t, now.AddDate(0, 0, 2*i).Format(`20060102`), task.Date)
+		}
+
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+		notFoundTask(t, id)
+	}
+	check(map[string]any{
+		"title":        "Три раза",
+		"repeat":       "d 2",
+		"repeat_count": 3,
+	}, 3)
+	check(map[string]any{
+		"title":        "До конца недели",
+		"repeat":       "d 2",
+		"repeat_until": now.AddDate(0, 0, 5).Format(`20060102`),
+	}, 3)
+}
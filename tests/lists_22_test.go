@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLists(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	login := fmt.Sprintf("user%d", time.Now().UnixNano())
+	ret, err := postJSON("api/users", map[string]any{"login": login, "password": "correct horse"}, http.MethodPost)
+	assert.NoError(t, err)
+	userID := fmt.Sprint(ret["id"])
+
+	// a list everyone writes to and a private list of the user
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.Exec(`INSERT INTO lists (name, owner_id, everyone, created_at) VALUES ('On-call', ?, 'write', ?)`, userID, now)
+	assert.NoError(t, err)
+	onCall, err := res.LastInsertId()
+	assert.NoError(t, err)
+	res, err = db.Exec(`INSERT INTO lists (name, owner_id, created_at) VALUES ('Личный', ?, ?)`, userID, now)
+	assert.NoError(t, err)
+	private, err := res.LastInsertId()
+	assert.NoError(t, err)
+
+	ret, err = getJSON("api/lists")
+	assert.NoError(t, err)
+	var names []any
+	for _, v := range ret["lists"].([]any) {
+		names = append(names, v.(map[string]any)["name"])
+	}
+	assert.Contains(t, names, "On-call")
+	assert.NotContains(t, names, "Личный")
+
+	today := time.Now().Format(`20060102`)
+	ret, err = postJSON("api/task", map[string]any{"date": today, "title": "Чужой список", "list_id": private}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+	ret, err = postJSON("api/task", map[string]any{"date": today, "title": "Дежурство", "list_id": onCall}, http.MethodPost)
+	assert.NoError(t, err)
+	id := fmt.Sprint(ret["id"])
+
+	ret, err = getJSON(fmt.Sprintf("api/tasks?list_id=%d", onCall))
+	assert.NoError(t, err)
+	assert.Len(t, ret["tasks"], 1)
+	ret, err = getJSON("api/task?id=" + id)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(onCall), ret["list_id"])
+
+	ret, err = postJSON(fmt.Sprintf("api/lists?id=%d", onCall), nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	// a task of the user leaves the list only with the user or a manager of the list
+	res, err = db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, owner_id, list_id) VALUES (?, 'Задача владельца', '', '', ?, ?)`, today, userID, onCall)
+	assert.NoError(t, err)
+	foreign, err := res.LastInsertId()
+	assert.NoError(t, err)
+	ret, err = postJSON(fmt.Sprintf("api/task/move?id=%d&list_id=0", foreign), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	// the tasks of a deleted account stay in its lists, the lists go to the admin
+	ret, err = postJSON("api/users?id="+userID, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	var owner int
+	assert.NoError(t, db.Get(&owner, `SELECT owner_id FROM lists WHERE id = ?`, onCall))
+	assert.Equal(t, 1, owner)
+	ret, err = postJSON(fmt.Sprintf("api/task/move?id=%d&list_id=0", foreign), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	_, err = postJSON(fmt.Sprintf("api/task?id=%d", foreign), nil, http.MethodDelete)
+	assert.NoError(t, err)
+
+	ret, err = postJSON(fmt.Sprintf("api/task/move?id=%s&list_id=0", id), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	var listID int
+	assert.NoError(t, db.Get(&listID, `SELECT list_id FROM scheduler WHERE id = ?`, id))
+	assert.Equal(t, 0, listID)
+
+	// a completed task is archived and does not keep the list from being deleted
+	ret, err = postJSON("api/task", map[string]any{"date": today, "title": "Выполнено", "list_id": onCall}, http.MethodPost)
+	assert.NoError(t, err)
+	done := fmt.Sprint(ret["id"])
+	op := undoable(t, "api/task/done?id="+done, http.MethodPost)
+
+	for _, list := range []int64{onCall, private} {
+		ret, err = postJSON(fmt.Sprintf("api/lists?id=%d", list), nil, http.MethodDelete)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+	}
+	var n int
+	assert.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM scheduler WHERE id = ?`, done))
+	assert.Equal(t, 0, n)
+	assert.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM task_completions WHERE task_id = ?`, done))
+	assert.Equal(t, 0, n)
+	assert.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM task_operations WHERE task_id = ?`, done))
+	assert.Equal(t, 0, n)
+	ret, err = postJSON("api/undo?op="+op, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+	_, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getNextDates(t *testing.T, date, repeat, count string) map[string]any {
+	values := url.Values{}
+	values.Set("now", "20240126")
+	values.Set("date", date)
+	values.Set("repeat", repeat)
+	values.Set("count", count)
+
+	req, err := http.NewRequest(http.MethodGet, getURL("api/nextdate?"+values.Encode()), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	return m
+}
+
+func TestNextDates(t *testing.T) {
+	m := getNextDates(t, "20240101", "m -1", "4")
+	assert.Equal(t, []any{"20240131", "20240229", "20240331", "20240430"}, m["dates"])
+
+	m = getNextDates(t, "20240101", "d 7", "3")
+	assert.Equal(t, []any{"20240129", "20240205", "20240212"}, m["dates"])
+
+	m = getNextDates(t, "20240101", "FREQ=WEEKLY;BYDAY=MO,WE;INTERVAL=2;COUNT=8", "10")
+	assert.Equal(t, []any{"20240129", "20240131", "20240212", "20240214"}, m["dates"])
+
+	// the dates stop at year 9999
+	m = getNextDates(t, "20240126", "FREQ=YEARLY;INTERVAL=400", "100")
+	assert.Empty(t, m["error"])
+	assert.Len(t, m["dates"], 19)
+	m = getNextDates(t, "99970101", "y", "100")
+	assert.Equal(t, []any{"99980101", "99990101"}, m["dates"])
+
+	for _, count := range []string{"0", "101", "ten"} {
+		m = getNextDates(t, "20240101", "y", count)
+		assert.NotEmpty(t, m["error"], count)
+	}
+}
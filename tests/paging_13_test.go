@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taskPage struct {
+	Tasks []map[string]any `json:"tasks"`
+	Total int              `json:"total"`
+	Next  string           `json:"next"`
+	Query string           `json:"query"`
+	Error string           `json:"error"`
+}
+
+func getTaskPage(t *testing.T, values url.Values) taskPage {
+	body, err := requestJSON("api/tasks?"+values.Encode(), nil, http.MethodGet)
+	assert.NoError(t, err)
+
+	var page taskPage
+	assert.NoError(t, json.Unmarshal(body, &page))
+	return page
+}
+
+func titles(page taskPage) []string {
+	var ret []string
+	for _, v := range page.Tasks {
+		ret = append(ret, fmt.Sprint(v["title"]))
+	}
+	return ret
+}
+
+func TestTasksPaging(t *testing.T) {
+	now := time.Now()
+	var ids []string
+	for i, v := range []string{"Страница Г", "Страница А", "Страница Д", "Страница Б", "Страница В"} {
+		ids = append(ids, addTask(t, task{
+			date:  now.AddDate(0, 0, 5-i).Format(`20060102`),
+			title: v,
+		}))
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	page := getTaskPage(t, url.Values{"search": {"Страница"}, "limit": {"2"}})
+	assert.Equal(t, 5, page.Total)
+	assert.Equal(t, []string{"Страница В", "Страница Б"}, titles(page))
+	assert.NotEmpty(t, page.Next)
+
+	page = getTaskPage(t, url.Values{"search": {"Страница"}, "limit": {"2"}, "after": {page.Next}})
+	assert.Equal(t, []string{"Страница Д", "Страница А"}, titles(page))
+	page = getTaskPage(t, url.Values{"search": {"Страница"}, "limit": {"2"}, "after": {page.Next}})
+	assert.Equal(t, []string{"Страница Г"}, titles(page))
+	assert.Empty(t, page.Next)
+
+	page = getTaskPage(t, url.Values{"search": {"Страница"}, "sort": {"-title"}, "limit": {"3"}, "offset": {"1"}})
+	assert.Equal(t, 5, page.Total)
+	assert.Equal(t, []string{"Страница Г", "Страница В", "Страница Б"}, titles(page))
+
+	page = getTaskPage(t, url.Values{"search": {"Страница"}, "sort": {"created"}})
+	assert.Equal(t, []string{"Страница Г", "Страница А", "Страница Д", "Страница Б", "Страница В"}, titles(page))
+	assert.Empty(t, page.Next)
+
+	next := getTaskPage(t, url.Values{"search": {"Страница"}, "limit": {"1"}}).Next
+	for _, v := range []url.Values{
+		{"sort": {"owner"}},
+		{"limit": {"0"}},
+		{"limit": {"501"}},
+		{"offset": {"-1"}},
+		{"after": {"???"}},
+		{"after": {next}, "offset": {"1"}},
+		{"after": {next}, "sort": {"title"}},
+	} {
+		page = getTaskPage(t, v)
+		assert.NotEmpty(t, page.Error, v)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority(t *testing.T) {
+	day := func(n int) string {
+		return time.Now().AddDate(0, 0, n).Format(`20060102`)
+	}
+	var ids []string
+	for _, v := range []struct {
+		date     string
+		title    string
+		priority int
+	}{
+		{day(2), "Приоритет низкий", 0},
+		{day(2), "Приоритет высокий", 3},
+		{day(2), "Приоритет средний", 1},
+		{day(1), "Приоритет вчера", 0},
+		{day(2), "Приоритет тоже средний", 1},
+	} {
+		ret, err := postJSON("api/task", map[string]any{"date": v.date, "title": v.title, "priority": v.priority}, http.MethodPost)
+		assert.NoError(t, err)
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	page := getTaskPage(t, url.Values{"search": {"Приоритет"}, "sort": {"priority"}})
+	assert.Equal(t, []string{"Приоритет вчера", "Приоритет высокий", "Приоритет средний",
+		"Приоритет тоже средний", "Приоритет низкий"}, titles(page))
+
+	ret, err := postJSON("api/tasks/reorder", map[string]any{"ids": []string{ids[4], ids[2]}}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	var got []string
+	after := ""
+	for {
+		values := url.Values{"search": {"Приоритет"}, "sort": {"priority"}, "limit": {"2"}}
+		if len(after) > 0 {
+			values.Set("after", after)
+		}
+		page = getTaskPage(t, values)
+		got = append(got, titles(page)...)
+		if after = page.Next; len(after) == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Приоритет вчера", "Приоритет высокий", "Приоритет тоже средний",
+		"Приоритет средний", "Приоритет низкий"}, got)
+
+	page = getTaskPage(t, url.Values{"search": {"Приоритет"}, "sort": {"-priority"}, "limit": {"1"}})
+	assert.Equal(t, []string{"Приоритет низкий"}, titles(page))
+
+	task, err := postJSON("api/task?id="+ids[2], nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), task["priority"])
+	assert.Equal(t, float64(1), task["position"])
+
+	for _, body := range []map[string]any{
+		{"date": day(2), "title": "Приоритет", "priority": 4},
+		{"date": day(2), "title": "Приоритет", "priority": -1},
+		{"date": day(2), "title": "Приоритет", "position": -1},
+	} {
+		ret, err = postJSON("api/task", body, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"])
+	}
+	for _, body := range []map[string]any{
+		{"ids": []string{}},
+		{"ids": []string{ids[0], ids[0]}},
+		{"ids": []string{ids[0], "999999"}},
+	} {
+		ret, err = postJSON("api/tasks/reorder", body, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"])
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchQuery(t *testing.T) {
+	now := time.Now()
+	soon, later := now.AddDate(0, 0, 3).Format(`20060102`), now.AddDate(0, 0, 30).Format(`20060102`)
+	ids := []string{
+		addTask(t, task{date: soon, title: "Запрос отчёт за месяц", comment: "draft версия"}),
+		addTask(t, task{date: later, title: "Запрос отчёт годовой", comment: "горячая вода, note: позвонить", repeat: "d 7"}),
+		addTask(t, task{date: soon, title: "Запрос купить воду", repeat: "w 1"}),
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	for _, v := range []struct {
+		q      string
+		titles []string
+	}{
+		{"запрос title:отчёт", []string{"Запрос отчёт за месяц", "Запрос отчёт годовой"}},
+		{"запрос title:отчёт -comment:draft", []string{"Запрос отчёт годовой"}},
+		{"запрос repeat:any date:>=" + later, []string{"Запрос отчёт годовой"}},
+		{"запрос repeat:w", []string{"Запрос купить воду"}},
+		{`запрос repeat:"d 7"`, []string{"Запрос отчёт годовой"}},
+		{"запрос repeat:none", []string{"Запрос отчёт за месяц"}},
+		{`запрос -"горячая вода" -воду`, []string{"Запрос отчёт за месяц"}},
+		{"запрос http://example.com/запрос", nil},
+		{"запрос Note: -нет:", []string{"Запрос отчёт годовой"}},
+		{"запрос date:<" + later + " date:" + now.AddDate(0, 0, 3).Format(`02.01.2006`), []string{"Запрос отчёт за месяц", "Запрос купить воду"}},
+	} {
+		page := getTaskPage(t, url.Values{"q": {v.q}})
+		assert.Empty(t, page.Error, v.q)
+		assert.Equal(t, v.titles, titles(page), v.q)
+	}
+
+	page := getTaskPage(t, url.Values{"q": {`date:>=` + soon + ` -comment:"горячая вода"  запрос`}})
+	assert.Equal(t, `date:>=`+soon+` -comment:"горячая вода" запрос`, page.Query)
+	assert.Equal(t, page.Tasks, getTaskPage(t, url.Values{"q": {page.Query}}).Tasks)
+
+	for _, q := range []string{"date:>=x", "tag:", `title:"отчёт`, "title:", "-"} {
+		page = getTaskPage(t, url.Values{"q": {q}})
+		assert.NotEmpty(t, page.Error, q)
+	}
+	page = getTaskPage(t, url.Values{"q": {"отчёт"}, "search": {"отчёт"}})
+	assert.NotEmpty(t, page.Error)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTasksRange(t *testing.T) {
+	base := time.Now().AddDate(0, 0, 10)
+	day := func(n int) string {
+		return base.AddDate(0, 0, n).Format(`20060102`)
+	}
+
+	ids := []string{
+		addTask(t, task{date: day(1), title: "Диапазон разовая"}),
+		addTask(t, task{date: day(0), title: "Диапазон неделя", repeat: "d 7"}),
+		addTask(t, task{date: day(20), title: "Диапазон позже", repeat: "d 1"}),
+	}
+	ret, err := postJSON("api/task", map[string]any{
+		"date":         day(0),
+		"title":        "Диапазон трижды",
+		"repeat":       "d 3",
+		"repeat_count": 3,
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	ids = append(ids, fmt.Sprint(ret["id"]))
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	page := getTaskPage(t, url.Values{"search": {"Диапазон"}, "from": {day(0)}, "to": {day(9)}})
+	assert.Empty(t, page.Error)
+	assert.Equal(t, 6, page.Total)
+	var got []string
+	for _, v := range page.Tasks {
+		got = append(got, fmt.Sprint(v["date"], " ", v["title"]))
+	}
+	assert.Equal(t, []string{
+		day(0) + " Диапазон неделя",
+		day(0) + " Диапазон трижды",
+		day(1) + " Диапазон разовая",
+		day(3) + " Диапазон трижды",
+		day(6) + " Диапазон трижды",
+		day(7) + " Диапазон неделя",
+	}, got)
+
+	page = getTaskPage(t, url.Values{"search": {"Диапазон"}, "from": {day(2)}, "to": {day(9)}, "limit": {"1"}, "offset": {"1"}})
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, []string{"Диапазон трижды"}, titles(page))
+	assert.Equal(t, day(6), page.Tasks[0]["date"])
+
+	for _, v := range []url.Values{
+		{"from": {day(0)}},
+		{"to": {day(0)}},
+		{"from": {day(5)}, "to": {day(0)}},
+		{"from": {day(0)}, "to": {day(400)}},
+		{"from": {"2024-01-01"}, "to": {day(0)}},
+		{"from": {day(0)}, "to": {day(1)}, "sort": {"title"}},
+	} {
+		page = getTaskPage(t, v)
+		assert.NotEmpty(t, page.Error, v)
+	}
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDateRRule(t *testing.T) {
+	tbl := []nextDate{
+		{"20240101", "FREQ=WEEKLY;BYDAY=MO,WE;INTERVAL=2;UNTIL=20261231", "20240129"},
+		{"20240101", "FREQ=DAILY;INTERVAL=10", "20240131"},
+		{"20240101", "FREQ=MONTHLY;BYMONTHDAY=-1", "20240131"},
+		{"20240115", "FREQ=MONTHLY;COUNT=2", "20240215"},
+		{"20230301", "FREQ=YEARLY", "20240301"},
+		{"20230101", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "20240229"},
+		{"20240119", "RRULE:FREQ=WEEKLY", "20240202"},
+		{"20240101", "FREQ=DAILY;UNTIL=20240127T000000Z", "20240127"},
+		{"20240101", "FREQ=DAILY;COUNT=3", ""},
+		{"20240101", "FREQ=DAILY;UNTIL=20240125", ""},
+		{"20240101", "FREQ=DAILY;COUNT=2;UNTIL=20250101", ""},
+		{"20240101", "FREQ=HOURLY", ""},
+		{"20240101", "FREQ=DAILY;BYSETPOS=1", ""},
+		{"20240101", "FREQ=WEEKLY;BYDAY=1MO", ""},
+		{"20240101", "INTERVAL=2", ""},
+	}
+	for _, v := range tbl {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=%s&repeat=%s",
+			url.QueryEscape(v.date), url.QueryEscape(v.repeat))
+		get, err := getBody(urlPath)
+		assert.NoError(t, err)
+		next := strings.TrimSpace(string(get))
+		_, err = time.Parse("20060102", next)
+		if err != nil && len(v.want) == 0 {
+			continue
+		}
+		assert.Equal(t, v.want, next, `{%q, %q, %q}`,
+			v.date, v.repeat, v.want)
+	}
+}
+
+func TestDoneRRuleCount(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Принять таблетку",
+		repeat: "FREQ=DAILY;INTERVAL=2;COUNT=3",
+	})
+
+	for i := 0; i < 2; i++ {
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+
+		var task Task
+		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+		now = now.AddDate(0, 0, 2)
+		assert.Equal(t, now.Format(`20060102`), task.Date)
+		assert.Equal(t, fmt.Sprintf("FREQ=DAILY;INTERVAL=2;COUNT=%d", 2-i), task.Repeat)
+	}
+
+	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	notFoundTask(t, id)
+}
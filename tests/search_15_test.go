@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullTextSearch(t *testing.T) {
+	date := time.Now().AddDate(0, 0, 2).Format(`20060102`)
+	ids := []string{
+		addTask(t, task{date: date, title: "Поиск Позвонить в УК", comment: "Горячая вода"}),
+		addTask(t, task{date: date, title: "Поиск купить воду", comment: "и хлеб"}),
+		addTask(t, task{date: date, title: "Поиск сходить", comment: "позвонить маме насчёт воды"}),
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	// case-insensitive prefix match in the title and the comment
+	page := getTaskPage(t, url.Values{"search": {"поиск ПОЗВОН"}})
+	assert.Equal(t, []string{"Поиск Позвонить в УК", "Поиск сходить"}, titles(page))
+	assert.Contains(t, page.Tasks[0]["snippet"], "<mark>Позвонить</mark>")
+
+	page = getTaskPage(t, url.Values{"search": {`поиск "горячая вода"`}})
+	assert.Equal(t, []string{"Поиск Позвонить в УК"}, titles(page))
+	page = getTaskPage(t, url.Values{"search": {`поиск "вода горячая"`}})
+	assert.Empty(t, page.Tasks)
+
+	// a match in the title ranks above a match in the comment, without rank the search goes by date
+	page = getTaskPage(t, url.Values{"search": {"поиск вод"}, "sort": {"rank"}})
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, "Поиск купить воду", titles(page)[0])
+	page = getTaskPage(t, url.Values{"search": {"поиск вод"}})
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, "Поиск Позвонить в УК", titles(page)[0])
+
+	// the ranked pages go on with a cursor
+	var ranked []string
+	values := url.Values{"search": {"поиск вод"}, "sort": {"rank"}, "limit": {"1"}}
+	for i := 0; i < 3; i++ {
+		page = getTaskPage(t, values)
+		assert.Empty(t, page.Error)
+		ranked = append(ranked, titles(page)...)
+		values.Set("after", page.Next)
+	}
+	assert.Empty(t, page.Next)
+	assert.Equal(t, titles(getTaskPage(t, url.Values{"search": {"поиск вод"}, "sort": {"rank"}})), ranked)
+
+	// the index follows the changes of a task
+	_, err := postJSON("api/task", map[string]any{
+		"id":    ids[1],
+		"date":  date,
+		"title": "Поиск купить молоко",
+	}, http.MethodPut)
+	assert.NoError(t, err)
+	page = getTaskPage(t, url.Values{"search": {"поиск молоко"}})
+	assert.Equal(t, []string{"Поиск купить молоко"}, titles(page))
+	page = getTaskPage(t, url.Values{"search": {"поиск хлеб"}})
+	assert.Empty(t, page.Tasks)
+
+	page = getTaskPage(t, url.Values{"sort": {"rank"}})
+	assert.NotEmpty(t, page.Error)
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tagList struct {
+	Tags []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"tags"`
+}
+
+func getTags(t *testing.T) map[string]string {
+	body, err := requestJSON("api/tags", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var list tagList
+	assert.NoError(t, json.Unmarshal(body, &list))
+	ret := make(map[string]string)
+	for _, v := range list.Tags {
+		ret[v.Name] = v.ID
+	}
+	return ret
+}
+
+func taskTags(t *testing.T, id string) []any {
+	task, err := getJSON("api/task?id=" + id)
+	assert.NoError(t, err)
+	tags, _ := task["tags"].([]any)
+	return tags
+}
+
+func getJSON(apipath string) (map[string]any, error) {
+	return postJSON(apipath, nil, http.MethodGet)
+}
+
+func TestTags(t *testing.T) {
+	date := time.Now().AddDate(0, 0, 2).Format(`20060102`)
+
+	ret, err := postJSON("api/tags", map[string]any{"name": " Дежурство "}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotNil(t, ret["id"])
+	oncall := fmt.Sprint(ret["id"])
+	ret, err = postJSON("api/tags", map[string]any{"name": "дежурство"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	ret, err = postJSON("api/task", map[string]any{
+		"date":  date,
+		"title": "Метки работа",
+		"tags":  []string{"Work", "team", "work"},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	work := fmt.Sprint(ret["id"])
+	ret, err = postJSON("api/task", map[string]any{
+		"date":  date,
+		"title": "Метки дежурство",
+		"tags":  []string{"дежурство"},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	duty := fmt.Sprint(ret["id"])
+	defer func() {
+		for _, id := range []string{work, duty} {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+		for _, name := range []string{"team", "personal"} {
+			if id, ok := getTags(t)[name]; ok {
+				_, err := postJSON("api/tags?id="+id, nil, http.MethodDelete)
+				assert.NoError(t, err)
+			}
+		}
+	}()
+
+	assert.Equal(t, []any{"team", "work"}, taskTags(t, work))
+	tags := getTags(t)
+	assert.Contains(t, tags, "team")
+	assert.Contains(t, tags, "work")
+
+	page := getTaskPage(t, url.Values{"search": {"Метки"}, "tag": {"work"}})
+	assert.Equal(t, []string{"Метки работа"}, titles(page))
+	page = getTaskPage(t, url.Values{"q": {"метки -tag:work"}})
+	assert.Equal(t, []string{"Метки дежурство"}, titles(page))
+	page = getTaskPage(t, url.Values{"q": {"метки tag:team tag:work"}})
+	assert.Equal(t, []string{"Метки работа"}, titles(page))
+
+	// an update without tags keeps them, an empty list removes them
+	_, err = postJSON("api/task", map[string]any{"id": work, "date": date, "title": "Метки работа"}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"team", "work"}, taskTags(t, work))
+	_, err = postJSON("api/task", map[string]any{"id": work, "date": date, "title": "Метки работа", "tags": []string{"team"}}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"team"}, taskTags(t, work))
+
+	// renaming and deleting a tag changes its tasks
+	_, err = postJSON("api/tags", map[string]any{"id": tags["team"], "name": "personal"}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"personal"}, taskTags(t, work))
+	ret, err = postJSON("api/tags", map[string]any{"id": tags["personal"], "name": "work"}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	_, err = postJSON("api/tags?id="+oncall, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, taskTags(t, duty))
+	assert.NotContains(t, getTags(t), "дежурство")
+	_, err = postJSON("api/tags?id="+tags["work"], nil, http.MethodDelete)
+	assert.NoError(t, err)
+
+	for _, body := range []map[string]any{
+		{"date": date, "title": "Метки", "tags": []string{"two words"}},
+		{"date": date, "title": "Метки", "tags": []string{""}},
+	} {
+		ret, err = postJSON("api/task", body, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"])
+	}
+	page = getTaskPage(t, url.Values{"tag": {"a b"}})
+	assert.NotEmpty(t, page.Error)
+}
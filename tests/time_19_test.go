@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskTime(t *testing.T) {
+	date := time.Now().AddDate(0, 0, 2).Format(`20060102`)
+	var ids []string
+	for _, v := range []map[string]any{
+		{"title": "Время созвон", "time": "16:00", "duration": 30, "timezone": "Europe/Moscow"},
+		{"title": "Время весь день"},
+		{"title": "Время утро", "time": "9:05"},
+	} {
+		v["date"] = date
+		ret, err := postJSON("api/task", v, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret["error"])
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+			assert.NoError(t, err)
+		}
+	}()
+
+	page := getTaskPage(t, url.Values{"search": {"Время"}})
+	assert.Equal(t, []string{"Время весь день", "Время утро", "Время созвон"}, titles(page))
+	assert.Equal(t, "09:05", page.Tasks[1]["time"])
+	assert.Equal(t, float64(30), page.Tasks[2]["duration"])
+	assert.Equal(t, "Europe/Moscow", page.Tasks[2]["timezone"])
+
+	var got []string
+	after := ""
+	for {
+		values := url.Values{"search": {"Время"}, "sort": {"-date"}, "limit": {"1"}}
+		if len(after) > 0 {
+			values.Set("after", after)
+		}
+		page = getTaskPage(t, values)
+		got = append(got, titles(page)...)
+		if after = page.Next; len(after) == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Время созвон", "Время утро", "Время весь день"}, got)
+
+	for _, body := range []map[string]any{
+		{"time": "25:00"},
+		{"time": "полдень"},
+		{"duration": 30},
+		{"timezone": "UTC"},
+		{"time": "10:00", "timezone": "Mars/Olympus"},
+		{"time": "10:00", "duration": -5},
+		{"time": "10:00", "duration": 24*60 + 1},
+	} {
+		body["date"], body["title"] = date, "Время"
+		ret, err := postJSON("api/task", body, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], body)
+	}
+}
+
+func TestTaskTimeDone(t *testing.T) {
+	now := time.Now().UTC()
+	if now.Hour() == 23 && now.Minute() >= 58 {
+		t.Skip("the time of the task is about to pass")
+	}
+	db := openDB(t)
+	defer db.Close()
+
+	// an overdue daily task whose time has not come yet today moves to today
+	res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, start_time, timezone)
+	VALUES (?, 'Время просрочено', '', 'd 1', '23:59', 'UTC')`, now.AddDate(0, 0, -3).Format(`20060102`))
+	assert.NoError(t, err)
+	id, err := res.LastInsertId()
+	assert.NoError(t, err)
+	defer func() {
+		_, err := postJSON(fmt.Sprintf("api/task?id=%d", id), nil, http.MethodDelete)
+		assert.NoError(t, err)
+	}()
+
+	ret, err := postJSON(fmt.Sprintf("api/task/done?id=%d", id), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	task, err := postJSON(fmt.Sprintf("api/task?id=%d", id), nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Format(`20060102`), task["date"])
+}
+
+func TestNextDateTime(t *testing.T) {
+	values := url.Values{}
+	// 10:30 in Moscow
+	values.Set("now", "2024-01-26T07:30:00Z")
+	values.Set("date", "20240101")
+	values.Set("repeat", "d 1")
+	values.Set("tz", "Europe/Moscow")
+	for clock, want := range map[string]string{"11:00": "20240126", "10:00": "20240127"} {
+		values.Set("time", clock)
+		body, err := getBody("api/nextdate?" + values.Encode())
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(body), clock)
+	}
+
+	for _, v := range []url.Values{{"time": {"25:00"}}, {"tz": {"Mars/Base"}}, {"now": {"2024-01-26 07:30"}}} {
+		bad := url.Values{"now": values["now"], "date": values["date"], "repeat": values["repeat"]}
+		for key, value := range v {
+			bad[key] = value
+		}
+		body, err := getBody("api/nextdate?" + bad.Encode())
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), "error", v)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// undoable calls a done or delete endpoint and returns the undo operation id.
+func undoable(t *testing.T, apipath string, method string) string {
+	req, err := http.NewRequest(method, getURL(apipath), nil)
+	assert.NoError(t, err)
+	if len(Token) > 0 {
+		req.AddCookie(&http.Cookie{Name: "token", Value: Token})
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	op := resp.Header.Get("X-Undo-Operation")
+	assert.NotEmpty(t, op)
+	return op
+}
+
+func TestUndo(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:    now.Format(`20060102`),
+		title:   "Удалить по ошибке",
+		comment: "Комментарий",
+		repeat:  "d 3",
+	})
+
+	op := undoable(t, "api/task?id="+id, http.MethodDelete)
+	notFoundTask(t, id)
+
+	ret, err := postJSON("api/undo?op="+op, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	m, err := postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "Удалить по ошибке", m["title"])
+	assert.Equal(t, "Комментарий", m["comment"])
+	assert.Equal(t, now.Format(`20060102`), m["date"])
+
+	ret, err = postJSON("api/undo?op="+op, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	first := undoable(t, "api/task/done?id="+id, http.MethodPost)
+	second := undoable(t, "api/task/done?id="+id, http.MethodPost)
+	assert.Len(t, getHistory(t, id), 2)
+
+	ret, err = postJSON("api/undo?op="+first, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	for _, op := range []string{second, first} {
+		ret, err = postJSON("api/undo?op="+op, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+	}
+	assert.Empty(t, getHistory(t, id))
+
+	var restored Task
+	err = db.Get(&restored, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Format(`20060102`), restored.Date)
+
+	ret, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	ret, err = postJSON("api/undo", nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// without TODO_PASSWORD the requests act as the admin account
+	ret, err := getJSON("api/users")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["users"])
+
+	login := fmt.Sprintf("user%d", time.Now().UnixNano())
+	ret, err = postJSON("api/users", map[string]any{"login": login, "password": "short"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+	ret, err = postJSON("api/users", map[string]any{"login": login, "password": "correct horse"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotNil(t, ret["id"])
+	userID := fmt.Sprint(ret["id"])
+	ret, err = postJSON("api/users", map[string]any{"login": login, "password": "correct horse"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	var hash string
+	assert.NoError(t, db.Get(&hash, `SELECT password_hash FROM users WHERE id = ?`, userID))
+	assert.NotEmpty(t, hash)
+	assert.NotContains(t, hash, "correct horse")
+
+	// the tasks of the user are not seen by the admin
+	today := time.Now().Format(`20060102`)
+	res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, owner_id) VALUES (?, 'Чужая задача', '', '', ?)`, today, userID)
+	assert.NoError(t, err)
+	id, err := res.LastInsertId()
+	assert.NoError(t, err)
+
+	ret, err = getJSON(fmt.Sprintf("api/task?id=%d", id))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+	tasks := getTasks(t, "Чужая")
+	assert.Empty(t, tasks)
+	ret, err = postJSON(fmt.Sprintf("api/task?id=%d", id), nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	ret, err = postJSON("api/task", map[string]any{"date": today, "title": "Своя задача"}, http.MethodPost)
+	assert.NoError(t, err)
+	var owner int
+	assert.NoError(t, db.Get(&owner, `SELECT owner_id FROM scheduler WHERE id = ?`, ret["id"]))
+	assert.Equal(t, 1, owner)
+	_, err = postJSON(fmt.Sprintf("api/task?id=%v", ret["id"]), nil, http.MethodDelete)
+	assert.NoError(t, err)
+
+	// the tasks go with the account
+	ret, err = postJSON("api/users?id="+userID, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	var n int
+	assert.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM scheduler WHERE id = ?`, id))
+	assert.Equal(t, 0, n)
+
+	ret, err = postJSON("api/users?id=1", nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
@@ -0,0 +1,58 @@
+// tags.js shows the tags of the tasks under their comments, #tag for each one.
+// The task list of scripts.min.js does not know about tags, so this script keeps
+// the last answer of api/tasks and adds the tags to the rendered cards, which are
+// in the same order as the tasks of the answer.
+(function () {
+    "use strict";
+
+    let tasks = [];
+
+    axios.interceptors.response.use(function (response) {
+        const url = response.config && response.config.url || "";
+        if (/(^|\/)api\/tasks(\?|$)/.test(url) && response.data && !response.data.error) {
+            tasks = response.data.tasks || [];
+        }
+        return response;
+    });
+
+    function tagText(task) {
+        return (task.tags || []).map(function (tag) { return "#" + tag; }).join(" ");
+    }
+
+    function showTags(root) {
+        const cards = root.querySelectorAll(".notelist .notecard");
+        if (cards.length !== tasks.length) {
+            return;
+        }
+        cards.forEach(function (card, i) {
+            const task = tasks[i];
+            const title = card.querySelector(".notetitle");
+            if (!title || title.textContent !== task.title) {
+                return;
+            }
+            const text = tagText(task);
+            let tags = card.querySelector(".notetags");
+            if (!text) {
+                if (tags) {
+                    tags.remove();
+                }
+                return;
+            }
+            if (!tags) {
+                tags = document.createElement("div");
+                tags.className = "notetext notetags";
+                const panel = card.querySelector(".note");
+                panel.insertBefore(tags, panel.querySelector(".notebtns"));
+            }
+            if (tags.textContent !== text) {
+                tags.textContent = text;
+            }
+        });
+    }
+
+    document.addEventListener("DOMContentLoaded", function () {
+        const root = document.getElementById("app");
+        new MutationObserver(function () { showTags(root); })
+            .observe(root, { childList: true, subtree: true, characterData: true });
+    });
+})();